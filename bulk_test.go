@@ -0,0 +1,159 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/tweets"
+	"github.com/nankys/twitter/types"
+	"github.com/nankys/twitter/users"
+)
+
+func TestBulkLookup(t *testing.T) {
+	var mu sync.Mutex
+	var active, maxActive, calls int
+
+	// Serve tweet lookups: Every ID ending in 7 is not found, and all the
+	// tweets are attributed to the same author.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		calls++
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		defer func() { mu.Lock(); active--; mu.Unlock() }()
+		time.Sleep(10 * time.Millisecond)
+
+		ids := strings.Split(req.URL.Query().Get("ids"), ",")
+		if len(ids) > 100 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var data, errs []string
+		for _, id := range ids {
+			if strings.HasSuffix(id, "7") {
+				errs = append(errs, fmt.Sprintf(`{"value":%q,"parameter":"ids","title":"Not Found Error",
+"type":"https://api.twitter.com/2/problems/resource-not-found"}`, id))
+			} else {
+				data = append(data, fmt.Sprintf(`{"id":%q,"text":"tweet %s","author_id":"12"}`, id, id))
+			}
+		}
+		fmt.Fprintf(w, `{"data":[%s],"errors":[%s],"includes":{"users":[{"id":"12","username":"jack"}]}}`,
+			strings.Join(data, ","), strings.Join(errs, ","))
+	}))
+	defer srv.Close()
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+	var ids []string
+	for i := 1; i <= 250; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	ids = append(ids, "1", "2", "3") // duplicates are looked up only once
+
+	rsp, err := tweets.BulkLookup(ids, &tweets.BulkOpts{
+		Concurrency: 2,
+		Optional:    []types.Fields{types.Expansions{AuthorID: true}},
+	}).Invoke(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("BulkLookup failed: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Server saw %d calls, want 3", calls)
+	}
+	if maxActive > 2 {
+		t.Errorf("Server saw %d concurrent calls, want at most 2", maxActive)
+	}
+	if len(rsp.Results) != 250 {
+		t.Errorf("Got %d results, want 250", len(rsp.Results))
+	}
+	if len(rsp.Tweets) != 225 || len(rsp.Errors) != 25 {
+		t.Errorf("Got %d tweets and %d errors, want 225 and 25", len(rsp.Tweets), len(rsp.Errors))
+	}
+	if r := rsp.Results["17"]; r == nil || r.Status() != types.StatusNotFound {
+		t.Errorf("Result for 17: got %+v, want not found", r)
+	}
+	if r := rsp.Results["201"]; r == nil || r.Tweet == nil || r.Tweet.Text != "tweet 201" {
+		t.Errorf("Result for 201: got %+v, want tweet", r)
+	}
+
+	// The author should be included exactly once, despite appearing in the
+	// includes of every batch.
+	var authors []json.RawMessage
+	if err := json.Unmarshal(rsp.Includes["users"], &authors); err != nil {
+		t.Fatalf("Decoding included users: %v", err)
+	} else if len(authors) != 1 {
+		t.Errorf("Got %d included users, want 1", len(authors))
+	}
+}
+
+func TestBulkLookupError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Query().Get("usernames"), "bad") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+	names := make([]string, 150)
+	for i := range names {
+		names[i] = fmt.Sprintf("user%d", i)
+	}
+	names[120] = "bad"
+	rsp, err := users.BulkLookupByName(names, &users.BulkOpts{Concurrency: 1}).Invoke(context.Background(), cli)
+	if err == nil {
+		t.Fatal("BulkLookupByName: got nil error, want unauthorized")
+	}
+	t.Logf("Got expected error: %v", err)
+
+	// The results of the batch that succeeded are reported with the error.
+	if rsp == nil {
+		t.Fatal("BulkLookupByName: got nil reply with error")
+	}
+	if len(rsp.Results) != 100 || rsp.Results["user0"] == nil || rsp.Results["user99"] == nil {
+		t.Errorf("Got %d results, want user0..user99", len(rsp.Results))
+	}
+	if r, ok := rsp.Results["user120"]; ok {
+		t.Errorf("Result for user120: got %+v, want none", r)
+	}
+}
+
+func TestBulkLookupByNameCase(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = append(got, req.URL.Query().Get("usernames"))
+		w.Write([]byte(`{"data":[{"id":"12","username":"jack"}]}`))
+	}))
+	defer srv.Close()
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+	names := []string{"Jack", "jack", "JACK"}
+	rsp, err := users.BulkLookupByName(names, nil).Invoke(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("BulkLookupByName failed: %v", err)
+	}
+	if len(got) != 1 || got[0] != "Jack" {
+		t.Errorf("Server saw usernames %q, want [Jack]", got)
+	}
+	for _, name := range names {
+		if r := rsp.Results[name]; r == nil || r.User == nil || r.User.ID != "12" {
+			t.Errorf("Result for %q: got %+v, want user 12", name, r)
+		}
+	}
+}
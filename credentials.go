@@ -0,0 +1,239 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/creachadair/jhttp"
+)
+
+// DefaultLimitWindow is the duration for which a credential is assumed to be
+// rate limited after a 429 response that does not report when the limit
+// resets.
+const DefaultLimitWindow = 15 * time.Minute
+
+// A Credential is a named authorizer in a CredentialPool. The authorizer may
+// attach either bearer (app-only) or user-context authorization.
+type Credential struct {
+	Name      string // used to identify the credential; must be unique in a pool
+	Authorize jhttp.Authorizer
+}
+
+// A CredentialPool holds a set of credentials, and chooses one to authorize
+// each call based on the rate limits the server has reported for each.
+//
+// For each call, the pool chooses the credential with the most quota
+// remaining for the target endpoint (see Endpoint). A credential whose quota
+// for the endpoint is not yet known is preferred over one that is known. If
+// the call fails because the credential is rate limited (HTTP 429), the pool
+// fails over to the next credential. If the call fails because the credential
+// is not authorized (HTTP 401), for example because it has been revoked, the
+// credential is quarantined and not used again until it is restored.
+//
+// A CredentialPool is safe for concurrent use by multiple clients.
+type CredentialPool struct {
+	// If true, a call for which every credential is rate limited waits until
+	// the earliest limit resets, or until its context ends. Otherwise, the
+	// call fails immediately with a *LimitError.
+	Wait bool
+
+	mu    sync.Mutex
+	creds []*pooledCred
+}
+
+type pooledCred struct {
+	Credential
+	limits      map[string]*RateLimit // :: endpoint → latest limit
+	quarantined error                 // if non-nil, the reason for quarantine
+}
+
+// NewCredentialPool constructs a pool containing the given credentials.
+func NewCredentialPool(creds ...Credential) *CredentialPool {
+	p := new(CredentialPool)
+	for _, c := range creds {
+		p.Add(c)
+	}
+	return p
+}
+
+// Add adds c to the pool. If the pool already has a credential with the same
+// name, it is replaced by c, and its recorded state is discarded.
+func (p *CredentialPool) Add(c Credential) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc := &pooledCred{Credential: c, limits: make(map[string]*RateLimit)}
+	for i, old := range p.creds {
+		if old.Name == c.Name {
+			p.creds[i] = pc
+			return
+		}
+	}
+	p.creds = append(p.creds, pc)
+}
+
+// Quarantined returns the names of the credentials in quarantine, mapped to
+// the errors that caused them to be quarantined.
+func (p *CredentialPool) Quarantined() map[string]error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]error)
+	for _, c := range p.creds {
+		if c.quarantined != nil {
+			out[c.Name] = c.quarantined
+		}
+	}
+	return out
+}
+
+// Restore releases the named credential from quarantine. It reports whether
+// the credential was quarantined.
+func (p *CredentialPool) Restore(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.creds {
+		if c.Name == name && c.quarantined != nil {
+			c.quarantined = nil
+			return true
+		}
+	}
+	return false
+}
+
+// Limit returns a copy of the most recent rate limit recorded for the named
+// credential and endpoint, or nil if no limit is known.
+func (p *CredentialPool) Limit(name, endpoint string) *RateLimit {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.creds {
+		if c.Name == name {
+			if rl, ok := c.limits[endpoint]; ok {
+				cp := *rl
+				return &cp
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// call invokes f with credentials from the pool for a call to endpoint, until
+// f succeeds, fails for a reason other than the credential, or there are no
+// more usable credentials. It reports the error from the last call of f.
+func (p *CredentialPool) call(ctx context.Context, endpoint string, f func(jhttp.Authorizer) (http.Header, error)) error {
+	tried := make(map[*pooledCred]bool)
+	var lastErr error
+	for {
+		pc, reset, err := p.pick(endpoint, tried)
+		if err != nil {
+			return err
+		} else if pc == nil && lastErr != nil {
+			return lastErr
+		} else if pc == nil {
+			if !p.Wait {
+				return &jhttp.Error{
+					Message: "request would exceed rate limit",
+					Err:     &LimitError{Endpoint: endpoint, Reset: reset},
+				}
+			}
+			t := time.NewTimer(time.Until(reset))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return &jhttp.Error{Message: "waiting for rate limit", Err: ctx.Err()}
+			case <-t.C:
+			}
+			continue
+		}
+
+		tried[pc] = true
+		header, err := f(pc.Authorize)
+		var jerr *jhttp.Error
+		if !errors.As(err, &jerr) {
+			p.update(pc, endpoint, decodeRateLimits(header), nil)
+			return err
+		}
+		switch jerr.Status {
+		case http.StatusTooManyRequests:
+			rl := decodeRateLimits(header)
+			if rl == nil || rl.Reset.IsZero() {
+				rl = &RateLimit{Reset: time.Now().Add(DefaultLimitWindow)}
+			}
+			rl.Remaining = 0
+			p.update(pc, endpoint, rl, nil)
+		case http.StatusUnauthorized:
+			p.update(pc, endpoint, nil, err)
+		default:
+			p.update(pc, endpoint, decodeRateLimits(header), nil)
+			return err
+		}
+		lastErr = err
+	}
+}
+
+// pick selects and reserves the untried credential with the most remaining
+// quota for endpoint. If every usable credential is rate limited, pick
+// returns nil and the earliest time one of them resets. If there are no
+// usable credentials at all, pick reports an error.
+func (p *CredentialPool) pick(endpoint string, tried map[*pooledCred]bool) (*pooledCred, time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best *pooledCred
+	var bestScore int
+	var reset time.Time
+	var usable bool
+	for _, c := range p.creds {
+		if c.quarantined != nil {
+			continue
+		}
+		usable = true
+		if tried[c] {
+			continue
+		}
+		score := math.MaxInt32 // quota unknown
+		if rl, ok := c.limits[endpoint]; ok {
+			if !now.Before(rl.Reset) {
+				delete(c.limits, endpoint) // the window has reset
+			} else if rl.Remaining <= 0 {
+				if reset.IsZero() || rl.Reset.Before(reset) {
+					reset = rl.Reset
+				}
+				continue
+			} else {
+				score = rl.Remaining
+			}
+		}
+		if best == nil || score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	if !usable {
+		return nil, time.Time{}, &jhttp.Error{Message: "no usable credentials in pool"}
+	} else if best != nil {
+		if rl, ok := best.limits[endpoint]; ok {
+			rl.Remaining-- // reserve a request from the current window
+		}
+	}
+	return best, reset, nil
+}
+
+// update records the outcome of a call using c. If rl != nil, it is recorded
+// as the current limit for endpoint. If qerr != nil, c is quarantined.
+func (p *CredentialPool) update(c *pooledCred, endpoint string, rl *RateLimit, qerr error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if qerr != nil {
+		c.quarantined = qerr
+	}
+	if rl != nil && !rl.Reset.IsZero() {
+		cp := *rl
+		c.limits[endpoint] = &cp
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+)
+
+func TestCredentialPool(t *testing.T) {
+	var mu sync.Mutex
+	quota := map[string]int{"a": 3, "b": 50}
+	used := make(map[string]int)
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		tok := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		used[tok]++
+		left, ok := quota[tok]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"title":"Unauthorized","type":"about:blank","status":401}`))
+			return
+		}
+		w.Header().Set("x-rate-limit-reset", reset)
+		if left <= 0 {
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		quota[tok] = left - 1
+		w.Header().Set("x-rate-limit-remaining", strconv.Itoa(left-1))
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	cred := func(name string) twitter.Credential {
+		return twitter.Credential{Name: name, Authorize: jhttp.BearerTokenAuthorizer(name)}
+	}
+	pool := twitter.NewCredentialPool(cred("a"), cred("b"), cred("revoked"))
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+	cli.Credentials = pool
+
+	ctx := context.Background()
+	call := func() error {
+		_, err := cli.Call(ctx, &jhttp.Request{Method: "2/tweets/search/recent"})
+		return err
+	}
+	checkUsed := func(want map[string]int) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		for name, n := range want {
+			if used[name] != n {
+				t.Errorf("Credential %q: used %d times, want %d", name, used[name], n)
+			}
+		}
+	}
+
+	// Each credential is tried once to discover its quota, and the revoked
+	// credential is quarantined. Thereafter, calls prefer b, which has the
+	// most quota remaining.
+	for i := 0; i < 5; i++ {
+		if err := call(); err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+	}
+	checkUsed(map[string]int{"a": 1, "b": 4, "revoked": 1})
+	if q := pool.Quarantined(); len(q) != 1 || !errors.Is(q["revoked"], twitter.ErrUnauthorized) {
+		t.Errorf("Quarantined: got %v, want revoked", q)
+	}
+	if rl := pool.Limit("b", "GET 2/tweets/search/recent"); rl == nil || rl.Remaining != 46 {
+		t.Errorf("Limit for b: got %+v, want 46 remaining", rl)
+	}
+
+	// When b is rate limited, the pool fails over to a.
+	mu.Lock()
+	quota["b"] = 0
+	mu.Unlock()
+	if err := call(); err != nil {
+		t.Fatalf("Call with failover failed: %v", err)
+	}
+	checkUsed(map[string]int{"a": 2, "b": 5})
+
+	// Once a is also exhausted, calls fail without reaching the server.
+	for err := error(nil); err == nil; err = call() {
+	}
+	checkUsed(map[string]int{"a": 3, "b": 5, "revoked": 1})
+	err := call()
+	var lerr *twitter.LimitError
+	if !errors.As(err, &lerr) || !errors.Is(err, twitter.ErrRateLimited) {
+		t.Errorf("Call with exhausted pool: got %v, want *LimitError", err)
+	}
+	checkUsed(map[string]int{"a": 3, "b": 5, "revoked": 1})
+
+	// A restored credential is used again.
+	if !pool.Restore("revoked") {
+		t.Error("Restore(revoked) reported false")
+	}
+	call()
+	checkUsed(map[string]int{"revoked": 2})
+}
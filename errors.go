@@ -0,0 +1,154 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter/types"
+)
+
+// Sentinel errors that match an *APIError or *LimitError via errors.Is. For
+// example:
+//
+//	rsp, err := q.Invoke(ctx, cli)
+//	if errors.Is(err, twitter.ErrNotFound) {
+//	   // ...
+//	}
+var (
+	ErrNotFound          = errors.New("resource not found")
+	ErrRateLimited       = errors.New("rate limit exceeded")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrForbidden         = errors.New("forbidden")
+	ErrClientNotEnrolled = errors.New("client not enrolled")
+	ErrUsageCapExceeded  = errors.New("usage cap exceeded")
+)
+
+// ProblemBase is the common prefix of the problem type URLs reported by the
+// API. The problem type is the suffix, e.g., "resource-not-found".
+const ProblemBase = "https://api.twitter.com/2/problems/"
+
+// An APIError describes an error reported by the API, either in the body of
+// a failed request or as an ErrorDetail in an otherwise successful reply.
+//
+// When a call fails with an error reported by the server, the *jhttp.Error
+// returned by the client wraps an *APIError, which can be recovered with
+// errors.As. Use errors.Is with the sentinel errors defined by this package
+// to classify the error.
+type APIError struct {
+	Status int    // HTTP status code; 0 for a partial error
+	Type   string // problem type URL, e.g., ProblemBase + "resource-not-found"
+	Title  string // e.g., "Not Found Error"
+	Detail string // for human consumption
+	Reason string // e.g., "client-not-enrolled"
+	Code   int    // API v1.1 error code, if reported
+
+	// For errors derived from an ErrorDetail, the original detail.
+	Partial *types.ErrorDetail
+}
+
+// Error satisfies the error interface.
+func (e *APIError) Error() string {
+	msg := e.Title
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Detail != "" && e.Detail != msg {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Problem returns the suffix of the problem type URL, for example
+// "resource-not-found", or "" if the type is not an API problem URL.
+func (e *APIError) Problem() string {
+	if strings.HasPrefix(e.Type, ProblemBase) {
+		return strings.TrimPrefix(e.Type, ProblemBase)
+	}
+	return ""
+}
+
+// Is reports whether e matches target, which should be one of the sentinel
+// errors defined by this package.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound || e.Problem() == "resource-not-found" ||
+			e.Code == 34 || e.Code == 50 || e.Code == 144
+	case ErrRateLimited:
+		return (e.Status == http.StatusTooManyRequests || e.Code == 88) && !e.Is(ErrUsageCapExceeded)
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized || e.Code == 32 || e.Code == 89
+	case ErrForbidden:
+		return e.Status == http.StatusForbidden || e.Problem() == "not-authorized-for-resource" ||
+			e.Is(ErrClientNotEnrolled)
+	case ErrClientNotEnrolled:
+		return e.Reason == "client-not-enrolled" || e.Problem() == "client-forbidden"
+	case ErrUsageCapExceeded:
+		return e.Problem() == "usage-capped" || e.Title == "UsageCapExceeded"
+	}
+	return false
+}
+
+// Is reports whether target is ErrRateLimited.
+func (e *LimitError) Is(target error) bool { return target == ErrRateLimited }
+
+// DetailError converts a partial error reported in the Errors field of a
+// Reply into an equivalent *APIError.
+func DetailError(d *types.ErrorDetail) *APIError {
+	detail := d.Detail
+	if detail == "" {
+		detail = strings.Join(d.Details, "; ")
+	}
+	return &APIError{
+		Type:    d.TypeURL,
+		Title:   d.Title,
+		Detail:  detail,
+		Reason:  d.Reason,
+		Partial: d,
+	}
+}
+
+// decodeAPIError decodes an error reported by the server with the given HTTP
+// status and response body. The body may be a v2 problem object, or a v1.1
+// error list.
+func decodeAPIError(status int, data []byte) *APIError {
+	var body struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+		Errors []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	json.Unmarshal(data, &body) // best effort; the status is authoritative
+	out := &APIError{
+		Status: status,
+		Type:   body.Type,
+		Title:  body.Title,
+		Detail: body.Detail,
+		Reason: body.Reason,
+	}
+	if len(body.Errors) != 0 {
+		out.Code = body.Errors[0].Code
+		if out.Title == "" {
+			out.Title = body.Errors[0].Message
+		}
+	}
+	return out
+}
+
+// withAPIError attaches an *APIError to err, if it is a *jhttp.Error reporting
+// a failed HTTP status from the server. Otherwise it returns err unmodified.
+func withAPIError(err error) error {
+	if jerr, ok := err.(*jhttp.Error); ok && jerr.Status != 0 && jerr.Err == nil {
+		jerr.Err = decodeAPIError(jerr.Status, jerr.Data)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/types"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   []error
+	}{
+		{404, `{"title":"Not Found Error","type":"https://api.twitter.com/2/problems/resource-not-found"}`,
+			[]error{twitter.ErrNotFound}},
+		{429, `{"title":"Too Many Requests","detail":"Too Many Requests","type":"about:blank","status":429}`,
+			[]error{twitter.ErrRateLimited}},
+		{429, `{"title":"UsageCapExceeded","detail":"Usage cap exceeded: Monthly product cap",
+		  "type":"https://api.twitter.com/2/problems/usage-capped"}`,
+			[]error{twitter.ErrUsageCapExceeded}},
+		{401, `{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`,
+			[]error{twitter.ErrUnauthorized}},
+		{403, `{"title":"Client Forbidden","reason":"client-not-enrolled",
+		  "type":"https://api.twitter.com/2/problems/client-forbidden"}`,
+			[]error{twitter.ErrForbidden, twitter.ErrClientNotEnrolled}},
+		{401, `{"errors":[{"code":89,"message":"Invalid or expired token."}]}`,
+			[]error{twitter.ErrUnauthorized}},
+		{502, `<html>bad gateway</html>`, nil},
+	}
+	all := []error{
+		twitter.ErrNotFound, twitter.ErrRateLimited, twitter.ErrUnauthorized,
+		twitter.ErrForbidden, twitter.ErrClientNotEnrolled, twitter.ErrUsageCapExceeded,
+	}
+	ctx := context.Background()
+	for _, test := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		_, err := cli.Call(ctx, &jhttp.Request{Method: "2/tweets"})
+		srv.Close()
+
+		var aerr *twitter.APIError
+		if !errors.As(err, &aerr) {
+			t.Errorf("Status %d: got error %v, want *APIError", test.status, err)
+			continue
+		} else if aerr.Status != test.status {
+			t.Errorf("Status %d: got APIError status %d", test.status, aerr.Status)
+		}
+		for _, target := range all {
+			want := false
+			for _, w := range test.want {
+				want = want || w == target
+			}
+			if got := errors.Is(err, target); got != want {
+				t.Errorf("Status %d: errors.Is(%v, %q) = %v, want %v", test.status, err, target, got, want)
+			}
+		}
+	}
+}
+
+func TestDetailError(t *testing.T) {
+	err := twitter.DetailError(&types.ErrorDetail{
+		Title:        "Not Found Error",
+		Detail:       "Could not find tweet with ids: [1].",
+		Parameter:    "ids",
+		Value:        "1",
+		ResourceType: "tweet",
+		TypeURL:      "https://api.twitter.com/2/problems/resource-not-found",
+	})
+	if !errors.Is(err, twitter.ErrNotFound) {
+		t.Errorf("DetailError: %v does not match ErrNotFound", err)
+	}
+	if got, want := err.Problem(), "resource-not-found"; got != want {
+		t.Errorf("Problem: got %q, want %q", got, want)
+	}
+	if got, want := err.Error(), "Not Found Error: Could not find tweet with ids: [1]."; got != want {
+		t.Errorf("Error: got %q, want %q", got, want)
+	}
+}
+
+func TestLimitErrorIs(t *testing.T) {
+	var err error = &twitter.LimitError{Endpoint: "GET 2/tweets", Reset: time.Now()}
+	if !errors.Is(err, twitter.ErrRateLimited) {
+		t.Errorf("LimitError %v does not match ErrRateLimited", err)
+	}
+}
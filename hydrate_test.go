@@ -0,0 +1,81 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nankys/twitter/tweets"
+)
+
+func TestHydrate(t *testing.T) {
+	cli := fixedServer(t, `{
+  "data": [
+    {"id":"1","text":"look at this","author_id":"10",
+     "attachments":{"media_keys":["3_100","3_999"],"poll_ids":["50"]},
+     "geo":{"place_id":"p1"},
+     "referenced_tweets":[{"type":"quoted","id":"2"},{"type":"replied_to","id":"404"}]},
+    {"id":"2","text":"original","author_id":"11",
+     "referenced_tweets":[{"type":"quoted","id":"1"}]}
+  ],
+  "includes": {
+    "users": [{"id":"10","username":"alice"},{"id":"11","username":"bob"}],
+    "media": [{"media_key":"3_100","type":"photo"}],
+    "polls": [{"id":"50","options":[{"position":1,"label":"yes"}]}],
+    "places": [{"id":"p1","full_name":"Manhattan, NY"}]
+  },
+  "errors": [
+    {"value":"404","detail":"Could not find tweet with referenced_tweets.id: [404].",
+     "title":"Not Found Error","resource_type":"tweet","parameter":"referenced_tweets.id",
+     "type":"https://api.twitter.com/2/problems/resource-not-found"}
+  ]}`)
+	rsp, err := tweets.Lookup("1", &tweets.LookupOpts{
+		More: []string{"2"},
+	}).Invoke(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	hs, err := rsp.Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate failed: %v", err)
+	}
+	if len(hs) != 2 {
+		t.Fatalf("Hydrate: got %d tweets, want 2", len(hs))
+	}
+
+	h := hs[0]
+	if h.Author == nil || h.Author.Username != "alice" {
+		t.Errorf("Author: got %+v, want alice", h.Author)
+	}
+	if len(h.Media) != 1 || h.Media[0].Key != "3_100" {
+		t.Errorf("Media: got %+v, want 3_100", h.Media)
+	}
+	if len(h.Polls) != 1 || h.Polls[0].ID != "50" {
+		t.Errorf("Polls: got %+v, want 50", h.Polls)
+	}
+	if h.Place == nil || h.Place.FullName != "Manhattan, NY" {
+		t.Errorf("Place: got %+v, want Manhattan", h.Place)
+	}
+
+	// The quoted tweet is hydrated in turn, and links back to the first.
+	if q := h.Ref("quoted"); q == nil || q.Author == nil || q.Author.Username != "bob" {
+		t.Errorf("Quoted: got %+v, want tweet by bob", q)
+	} else if q != hs[1] || q.Ref("quoted") != h {
+		t.Error("Quoted: hydrated tweets are not shared")
+	}
+	if r := h.Ref("replied_to"); r != nil {
+		t.Errorf("Replied to: got %+v, want nil", r)
+	}
+
+	// The missing media and replied-to tweet are reported.
+	if len(h.Missing) != 2 {
+		t.Fatalf("Missing: got %d, want 2", len(h.Missing))
+	}
+	if m := h.Missing[0]; m.Field != "attachments.media_keys" || m.ID != "3_999" || m.Error != nil {
+		t.Errorf("Missing[0]: got %+v, want media 3_999 without error", m)
+	}
+	if m := h.Missing[1]; m.Field != "referenced_tweets.id" || m.ID != "404" || m.Error == nil {
+		t.Errorf("Missing[1]: got %+v, want tweet 404 with error", m)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/creachadair/jhttp"
+)
+
+// A CallKind identifies which method of a Client issued an Exchange.
+type CallKind int
+
+// Constants for CallKind.
+const (
+	KindCall    CallKind = iota + 1 // Client.Call
+	KindCallRaw                     // Client.CallRaw
+	KindStream                      // Client.Stream
+)
+
+func (k CallKind) String() string {
+	switch k {
+	case KindCall:
+		return "Call"
+	case KindCallRaw:
+		return "CallRaw"
+	case KindStream:
+		return "Stream"
+	}
+	return "CallKind(?)"
+}
+
+// An Exchange describes a single call to the API, as seen by an Interceptor.
+// The request fields are populated before the chain is invoked; the response
+// fields are populated by the innermost handler.
+type Exchange struct {
+	Kind    CallKind
+	Request *jhttp.Request
+
+	// The HTTP response headers, if a response was received. For a stream,
+	// this is set as soon as the stream is established.
+	Header http.Header
+
+	// The raw response body (Call and CallRaw only).
+	Body []byte
+
+	// The decoded response (Call only).
+	Reply *Reply
+
+	// The number of response body bytes received. For a stream, this is
+	// updated as each message arrives, before it is delivered to Callback.
+	Bytes int64
+
+	// The callback receiving replies from the stream (Stream only). An
+	// interceptor may wrap this to observe or filter the stream.
+	Callback Callback
+
+	// The monitor recording the health of the stream (Stream only).
+	Monitor *StreamMonitor
+}
+
+// RateLimit returns the rate limit reported by the response headers of ex, or
+// nil if there are none.
+func (ex *Exchange) RateLimit() *RateLimit { return decodeRateLimits(ex.Header) }
+
+// A Handler executes an exchange, populating its response fields.
+type Handler func(ctx context.Context, ex *Exchange) error
+
+// An Interceptor wraps the execution of an exchange. It may inspect or modify
+// ex before and after calling next, replace the error reported by next, or
+// satisfy the exchange itself without calling next at all.
+//
+// An interceptor that does not call next for a Call must populate either
+// ex.Reply or ex.Body; for CallRaw it must populate ex.Body.
+type Interceptor func(ctx context.Context, ex *Exchange, next Handler) error
+
+// exchange runs ex through the interceptors of c, ending with h.
+func (c *Client) exchange(ctx context.Context, ex *Exchange, h Handler) error {
+	for i := len(c.Interceptors) - 1; i >= 0; i-- {
+		ic, next := c.Interceptors[i], h
+		h = func(ctx context.Context, ex *Exchange) error { return ic(ctx, ex, next) }
+	}
+	return h(ctx, ex)
+}
+
+// invoke is the innermost handler for Call and CallRaw exchanges.
+func (c *Client) invoke(ctx context.Context, ex *Exchange) error {
+	header, body, err := c.call(ctx, ex.Request)
+	ex.Header, ex.Body = header, body
+	ex.Bytes = int64(len(body))
+	if err != nil {
+		return err
+	}
+	if ex.Kind == KindCall {
+		ex.Reply, err = decodeReply(header, body)
+	}
+	return err
+}
+
+// decodeReply decodes a reply from the given response header and body.
+func decodeReply(header http.Header, body []byte) (*Reply, error) {
+	var reply Reply
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, &jhttp.Error{Data: body, Message: "decoding response body", Err: err}
+	}
+	reply.RateLimit = decodeRateLimits(header)
+	return &reply, nil
+}
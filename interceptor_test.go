@@ -0,0 +1,144 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+)
+
+func TestInterceptors(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.Header().Set("x-rate-limit-remaining", "99")
+		if strings.HasSuffix(req.URL.Path, "/stream") {
+			for i := 1; i <= 3; i++ {
+				fmt.Fprintf(w, "{\"data\":{\"id\":\"%d\"}}\r\n", i)
+			}
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"id":%q}}`, req.URL.Query().Get("tag"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	t.Run("Order", func(t *testing.T) {
+		var log []string
+		trace := func(name string) twitter.Interceptor {
+			return func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+				log = append(log, name+" "+ex.Kind.String())
+				err := next(ctx, ex)
+				log = append(log, fmt.Sprintf("%s %s remaining=%d", name, ex.Reply.Data, ex.RateLimit().Remaining))
+				return err
+			}
+		}
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Interceptors = []twitter.Interceptor{trace("A"), trace("B")}
+
+		if _, err := cli.Call(ctx, &jhttp.Request{
+			Method: "2/tweets",
+			Params: jhttp.Params{"tag": []string{"1"}},
+		}); err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		got := strings.Join(log, "; ")
+		want := `A Call; B Call; B {"id":"1"} remaining=99; A {"id":"1"} remaining=99`
+		if got != want {
+			t.Errorf("Interceptor log:\ngot  %s\nwant %s", got, want)
+		}
+	})
+
+	t.Run("Mutate", func(t *testing.T) {
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Interceptors = []twitter.Interceptor{
+			func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+				ex.Request.Params = jhttp.Params{"tag": []string{"mutated"}}
+				return next(ctx, ex)
+			},
+		}
+		body, err := cli.CallRaw(ctx, &jhttp.Request{Method: "2/tweets"})
+		if err != nil {
+			t.Fatalf("CallRaw failed: %v", err)
+		}
+		if got, want := string(body), `{"data":{"id":"mutated"}}`; got != want {
+			t.Errorf("CallRaw: got %#q, want %#q", got, want)
+		}
+	})
+
+	t.Run("ShortCircuit", func(t *testing.T) {
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Interceptors = []twitter.Interceptor{
+			func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+				ex.Body = []byte(`{"data":{"id":"cached"}}`)
+				return nil
+			},
+		}
+		before := calls
+		rsp, err := cli.Call(ctx, &jhttp.Request{Method: "2/tweets"})
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		if got, want := string(rsp.Data), `{"id":"cached"}`; got != want {
+			t.Errorf("Call: got %#q, want %#q", got, want)
+		}
+		if calls != before {
+			t.Errorf("Server saw %d calls, want 0", calls-before)
+		}
+	})
+
+	t.Run("Fault", func(t *testing.T) {
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Interceptors = []twitter.Interceptor{
+			func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+				return &jhttp.Error{Status: http.StatusServiceUnavailable, Message: "injected"}
+			},
+		}
+		_, err := cli.Call(ctx, &jhttp.Request{Method: "2/tweets"})
+		var jerr *jhttp.Error
+		if !errors.As(err, &jerr) || jerr.Status != http.StatusServiceUnavailable {
+			t.Errorf("Call: got error %v, want injected fault", err)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		var header http.Header
+		var seen []string
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Interceptors = []twitter.Interceptor{
+			func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+				f := ex.Callback
+				ex.Callback = func(rsp *twitter.Reply) error {
+					header = ex.Header
+					seen = append(seen, string(rsp.Data))
+					return f(rsp)
+				}
+				return next(ctx, ex)
+			},
+		}
+		var nr int
+		if err := cli.Stream(ctx, &jhttp.Request{Method: "2/tweets/search/stream"}, func(*twitter.Reply) error {
+			nr++
+			if nr == 2 {
+				return jhttp.ErrStopStreaming
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		if len(seen) != 2 {
+			t.Errorf("Interceptor saw %d replies, want 2", len(seen))
+		}
+		if got := header.Get("x-rate-limit-remaining"); got != "99" {
+			t.Errorf("Stream header: got remaining %q, want 99", got)
+		}
+	})
+}
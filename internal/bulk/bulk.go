@@ -0,0 +1,110 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+// Package bulk carries shared code for splitting large lookups into batches
+// that are issued concurrently.
+package bulk
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nankys/twitter/types"
+)
+
+// MaxBatchSize is the maximum number of keys the API accepts in a single
+// lookup request.
+const MaxBatchSize = 100
+
+// DefaultConcurrency is the default number of concurrent batch requests.
+const DefaultConcurrency = 4
+
+// Opts provides parameters for a bulk lookup. A nil *Opts provides empty
+// values for all fields.
+type Opts struct {
+	// The maximum number of concurrent requests. If zero, the default is 4.
+	Concurrency int
+
+	// Optional response fields and expansions.
+	Optional []types.Fields
+}
+
+// Concurrency returns the concurrency limit of o, or 0 for the default.
+func Concurrency(o *Opts) int {
+	if o == nil {
+		return 0
+	}
+	return o.Concurrency
+}
+
+// Optional returns the optional fields and expansions of o.
+func Optional(o *Opts) []types.Fields {
+	if o == nil {
+		return nil
+	}
+	return o.Optional
+}
+
+// Split partitions keys into batches of at most size elements, discarding
+// duplicate keys. The order of first occurrence is preserved. If norm != nil,
+// keys are duplicates if they are equal after norm is applied.
+func Split(keys []string, size int, norm func(string) string) [][]string {
+	seen := make(map[string]bool, len(keys))
+	var batches [][]string
+	var cur []string
+	for _, key := range keys {
+		nk := key
+		if norm != nil {
+			nk = norm(key)
+		}
+		if seen[nk] {
+			continue
+		}
+		seen[nk] = true
+		cur = append(cur, key)
+		if len(cur) == size {
+			batches = append(batches, cur)
+			cur = nil
+		}
+	}
+	if len(cur) != 0 {
+		batches = append(batches, cur)
+	}
+	return batches
+}
+
+// Run calls f concurrently for each of the given batches, with at most n
+// calls active at once. If n <= 0, DefaultConcurrency is used. Run returns
+// the first error reported by f, if any; when f fails, the context passed to
+// calls that are still active is canceled, and no further calls are made.
+func Run(ctx context.Context, batches [][]string, n int, f func(ctx context.Context, i int, batch []string) error) error {
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	sem := make(chan struct{}, n)
+loop:
+	for i, batch := range batches {
+		select {
+		case <-ctx.Done():
+			break loop
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i int, batch []string) {
+			defer func() { <-sem; wg.Done() }()
+			if err := f(ctx, i, batch); err != nil {
+				once.Do(func() { first = err; cancel() })
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+	if first == nil {
+		return ctx.Err()
+	}
+	return first
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/jhttp"
+)
+
+// A Limiter records the rate limits reported by the server for each endpoint,
+// and checks them before a request is sent. A zero Limiter is ready for use,
+// and fails fast when a request would exceed the limit for its endpoint.
+//
+// A Limiter is safe for concurrent use by multiple clients.
+type Limiter struct {
+	// If true, a request that would exceed the rate limit for its endpoint
+	// waits until the limit resets, or until its context ends. Otherwise, the
+	// request fails immediately with a *LimitError.
+	Wait bool
+
+	mu      sync.Mutex
+	buckets map[string]*RateLimit // :: endpoint → latest limit
+}
+
+// Limit returns a copy of the most recent rate limit recorded for the given
+// endpoint key (see Endpoint), or nil if no limit is known.
+func (l *Limiter) Limit(endpoint string) *RateLimit {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[endpoint]; ok {
+		cp := *b
+		return &cp
+	}
+	return nil
+}
+
+// acquire reserves a request against the limit for endpoint. If the limit is
+// exhausted, it either waits for the reset time or reports a *LimitError.
+// A nil *Limiter accepts all requests without delay.
+func (l *Limiter) acquire(ctx context.Context, endpoint string) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		b, ok := l.buckets[endpoint]
+		if ok && !time.Now().Before(b.Reset) {
+			// The window has reset, and we do not know the new limits until the
+			// server tells us about them.
+			delete(l.buckets, endpoint)
+			ok = false
+		}
+		if !ok || b.Remaining > 0 {
+			if ok {
+				b.Remaining-- // reserve a request from the current window
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		reset := b.Reset
+		l.mu.Unlock()
+
+		if !l.Wait {
+			return &jhttp.Error{
+				Message: "request would exceed rate limit",
+				Err:     &LimitError{Endpoint: endpoint, Reset: reset},
+			}
+		}
+		t := time.NewTimer(time.Until(reset))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return &jhttp.Error{Message: "waiting for rate limit", Err: ctx.Err()}
+		case <-t.C:
+		}
+	}
+}
+
+// update records rl as the current limit for endpoint. If rl == nil, update
+// does nothing. A nil *Limiter discards all updates.
+func (l *Limiter) update(endpoint string, rl *RateLimit) {
+	if l == nil || rl == nil || rl.Reset.IsZero() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*RateLimit)
+	}
+	cp := *rl
+	l.buckets[endpoint] = &cp
+}
+
+// LimitError is the error reported when a request would exceed the rate limit
+// for its endpoint.
+type LimitError struct {
+	Endpoint string    // the endpoint key, e.g., "GET 2/users/:id/followers"
+	Reset    time.Time // when the rate limit window resets
+}
+
+// Error satisfies the error interface.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("rate limit for %s is exhausted until %s",
+		e.Endpoint, e.Reset.Format(time.RFC3339))
+}
+
+// Endpoint returns the key used to track rate limits for req. The key is the
+// HTTP method and the API method path, with path parameters replaced by their
+// names: numeric ID segments are replaced by ":id", and named parameters such
+// as a username by the name of the parameter. For example, a GET for
+// "2/users/12/followers" has key "GET 2/users/:id/followers", and a GET for
+// "2/users/by/username/jack" has key "GET 2/users/by/username/:username".
+func Endpoint(req *jhttp.Request) string {
+	method := req.HTTPMethod
+	if method == "" {
+		method = "GET"
+	}
+	parts := strings.Split(strings.Trim(req.Method, "/"), "/")
+	for i, p := range parts[1:] { // skip the API version
+		base := strings.TrimSuffix(p, ".json") // for API v1.1 methods
+		if name, ok := pathParams[parts[i]]; ok && base != "" {
+			parts[i+1] = name + p[len(base):]
+		} else if isNumeric(base) {
+			parts[i+1] = ":id" + p[len(base):]
+		}
+	}
+	return method + " " + strings.Join(parts, "/")
+}
+
+// pathParams maps path segments to the names of the non-numeric parameters
+// that follow them in a method path.
+var pathParams = map[string]string{
+	"username": ":username", // 2/users/by/username/:username
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
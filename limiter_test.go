@@ -0,0 +1,95 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		req  *jhttp.Request
+		want string
+	}{
+		{&jhttp.Request{Method: "2/tweets"}, "GET 2/tweets"},
+		{&jhttp.Request{Method: "2/users/12/followers"}, "GET 2/users/:id/followers"},
+		{&jhttp.Request{Method: "2/users/12/likes/345", HTTPMethod: "DELETE"},
+			"DELETE 2/users/:id/likes/:id"},
+		{&jhttp.Request{Method: "1.1/statuses/destroy/99.json", HTTPMethod: "POST"},
+			"POST 1.1/statuses/destroy/:id.json"},
+		{&jhttp.Request{Method: "2/users/by/username/jack"}, "GET 2/users/by/username/:username"},
+		{&jhttp.Request{Method: "2/users/by/username/Alice_99"}, "GET 2/users/by/username/:username"},
+		{&jhttp.Request{Method: "2/users/by"}, "GET 2/users/by"},
+	}
+	for _, test := range tests {
+		if got := twitter.Endpoint(test.req); got != test.want {
+			t.Errorf("Endpoint(%q): got %q, want %q", test.req.Method, got, test.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	var calls int
+	reset := time.Now().Add(time.Second).Truncate(time.Second).Add(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		remaining := 2 - calls
+		if remaining < 0 {
+			remaining = 0
+		}
+		w.Header().Set("x-rate-limit-limit", "2")
+		w.Header().Set("x-rate-limit-remaining", strconv.Itoa(remaining))
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+	cli.Limiter = new(twitter.Limiter)
+	ctx := context.Background()
+	req := &jhttp.Request{Method: "2/users/12/followers"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := cli.Call(ctx, req); err != nil {
+			t.Fatalf("Call %d: unexpected error: %v", i+1, err)
+		}
+	}
+	if rl := cli.Limiter.Limit("GET 2/users/:id/followers"); rl == nil || rl.Remaining != 0 {
+		t.Errorf("Limit: got %+v, want remaining 0", rl)
+	}
+
+	// The limit is exhausted, so the next call should fail without a request.
+	_, err := cli.Call(ctx, &jhttp.Request{Method: "2/users/99/followers"})
+	var lerr *twitter.LimitError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("Call: got error %v, want *LimitError", err)
+	} else if lerr.Endpoint != "GET 2/users/:id/followers" {
+		t.Errorf("LimitError endpoint: got %q", lerr.Endpoint)
+	}
+	if calls != 2 {
+		t.Errorf("Server saw %d calls, want 2", calls)
+	}
+
+	// Other endpoints are not affected.
+	if _, err := cli.Call(ctx, &jhttp.Request{Method: "2/users/12/following"}); err != nil {
+		t.Errorf("Call to other endpoint: unexpected error: %v", err)
+	}
+
+	// With waiting enabled, the call should block until the reset time.
+	cli.Limiter.Wait = true
+	if _, err := cli.Call(ctx, req); err != nil {
+		t.Errorf("Call after wait: unexpected error: %v", err)
+	}
+	if now := time.Now(); now.Before(reset) {
+		t.Errorf("Call returned at %v, before reset at %v", now, reset)
+	}
+}
@@ -194,6 +194,21 @@ func (q Query) HasMorePages() bool {
 // invoking the query will then fetch the first page of results.
 func (q Query) ResetPageToken() { q.Request.Params.Reset(twitter.NextTokenParam) }
 
+// FetchPage invokes the query to fetch the next page of results. The page
+// reply is a *Reply, and its items are *types.List values. This method
+// satisfies the twitter.Pageable interface.
+func (q Query) FetchPage(ctx context.Context, cli *twitter.Client) (*twitter.Page, error) {
+	rsp, err := q.Invoke(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, len(rsp.Lists))
+	for i, v := range rsp.Lists {
+		items[i] = v
+	}
+	return &twitter.Page{Reply: rsp, Items: items}, nil
+}
+
 // A Reply is the response from a Query.
 type Reply struct {
 	*twitter.Reply
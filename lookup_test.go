@@ -0,0 +1,96 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/tweets"
+	"github.com/nankys/twitter/types"
+	"github.com/nankys/twitter/users"
+)
+
+func fixedServer(t *testing.T, body string) *twitter.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+}
+
+func TestLookupResults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Tweets", func(t *testing.T) {
+		cli := fixedServer(t, `{
+  "data": [{"id":"1","text":"hello"}],
+  "errors": [
+    {"value":"2","detail":"Could not find tweet with ids: [2].","title":"Not Found Error",
+     "resource_type":"tweet","parameter":"ids",
+     "type":"https://api.twitter.com/2/problems/resource-not-found"},
+    {"value":"3","detail":"Sorry, you are not authorized to see the Tweet with ids: [3].",
+     "title":"Authorization Error","resource_type":"tweet","parameter":"ids",
+     "type":"https://api.twitter.com/2/problems/not-authorized-for-resource"},
+    {"value":"99","detail":"Could not find user with author_id: [99].","title":"Not Found Error",
+     "resource_type":"user","parameter":"author_id",
+     "type":"https://api.twitter.com/2/problems/resource-not-found"}
+  ]}`)
+		rsp, err := tweets.Lookup("1", &tweets.LookupOpts{
+			More: []string{"2", "3", "4"},
+		}).Invoke(ctx, cli)
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		want := map[string]types.ResourceStatus{
+			"1": types.StatusFound,
+			"2": types.StatusNotFound,
+			"3": types.StatusProtected,
+			"4": types.StatusNotFound, // not mentioned at all
+		}
+		if len(rsp.Results) != len(want) {
+			t.Errorf("Got %d results, want %d", len(rsp.Results), len(want))
+		}
+		for id, status := range want {
+			r, ok := rsp.Results[id]
+			if !ok {
+				t.Errorf("Missing result for ID %q", id)
+			} else if got := r.Status(); got != status {
+				t.Errorf("Result for ID %q: got %q, want %q", id, got, status)
+			}
+		}
+		if r := rsp.Results["1"]; r.Tweet == nil || r.Tweet.Text != "hello" {
+			t.Errorf("Result for ID 1: got %+v, want tweet", r)
+		}
+		if r := rsp.Results["4"]; r.Error != nil {
+			t.Errorf("Result for ID 4: unexpected error %+v", r.Error)
+		}
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		cli := fixedServer(t, `{
+  "data": [{"id":"12","name":"jack","username":"jack"}],
+  "errors": [
+    {"value":"Suspendo","detail":"User has been suspended: [Suspendo].","title":"Forbidden",
+     "resource_type":"user","parameter":"usernames",
+     "type":"https://api.twitter.com/2/problems/resource-not-found"}
+  ]}`)
+		rsp, err := users.LookupByName("Jack", &users.LookupOpts{
+			More: []string{"suspendo"},
+		}).Invoke(ctx, cli)
+		if err != nil {
+			t.Fatalf("LookupByName failed: %v", err)
+		}
+		if r := rsp.Results["Jack"]; r == nil || r.User == nil || r.User.ID != "12" {
+			t.Errorf("Result for Jack: got %+v, want user 12", r)
+		}
+		if r := rsp.Results["suspendo"]; r == nil || r.Status() != types.StatusSuspended {
+			t.Errorf("Result for suspendo: got %+v, want suspended", r)
+		}
+	})
+}
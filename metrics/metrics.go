@@ -0,0 +1,420 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+// Package metrics collects per-endpoint metrics for the calls issued by a
+// twitter.Client.
+//
+// # Collecting Metrics
+//
+// A Collector records metrics through an interceptor installed on the client:
+//
+//	m := new(metrics.Collector)
+//	cli.Interceptors = append(cli.Interceptors, m.Interceptor())
+//
+// For each endpoint (see twitter.Endpoint) the collector records the number
+// of requests issued, errors by HTTP status, call latency, response bytes
+// received, and the rate limit most recently reported by the server. For
+// streams, it also records the number of messages received and the average
+// rate of messages over the last RateWindow.
+//
+// # Exporting Metrics
+//
+// A Collector is an http.Handler that serves its metrics in the Prometheus
+// text exposition format:
+//
+//	http.Handle("/metrics", m)
+//
+// To publish the metrics as an expvar, use Publish:
+//
+//	m.Publish("twitter")
+//
+// The same data are available to the program as a snapshot from Stats.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets used by a Collector that does not specify its own.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// RateWindow is the interval over which stream message rates are averaged.
+const RateWindow = time.Minute
+
+// A Collector records metrics for the calls issued by a client. A zero
+// Collector is ready for use. A Collector is safe for concurrent use, and may
+// be shared by multiple clients.
+type Collector struct {
+	// The upper bounds, in seconds, of the latency histogram buckets, in
+	// increasing order. If empty, DefaultBuckets is used. This field must not
+	// be modified once the collector is in use.
+	Buckets []float64
+
+	mu    sync.Mutex
+	stats map[string]*endpoint
+}
+
+// Interceptor returns an interceptor that records metrics for each call in c.
+// Latency is recorded for Call and CallRaw; a stream is counted as a single
+// request, and its messages are counted as they arrive.
+func (c *Collector) Interceptor() twitter.Interceptor {
+	return func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+		key := twitter.Endpoint(ex.Request)
+		c.update(key, func(e *endpoint) { e.requests++ })
+
+		if ex.Kind == twitter.KindStream {
+			f := ex.Callback
+			var last int64
+			ex.Callback = func(rsp *twitter.Reply) error {
+				nb := ex.Bytes - last
+				last = ex.Bytes
+				now := time.Now()
+				c.update(key, func(e *endpoint) {
+					e.bytes += nb
+					e.messages++
+					e.window.add(now)
+					if e.limit == nil {
+						e.limit = ex.RateLimit()
+					}
+				})
+				return f(rsp)
+			}
+		}
+
+		start := time.Now()
+		err := next(ctx, ex)
+		elapsed := time.Since(start)
+
+		c.update(key, func(e *endpoint) {
+			if err != nil {
+				var status int
+				var jerr *jhttp.Error
+				if errors.As(err, &jerr) {
+					status = jerr.Status
+				}
+				e.errors[status]++
+			}
+			if ex.Kind != twitter.KindStream {
+				e.bytes += ex.Bytes
+				e.latency.observe(elapsed.Seconds())
+			}
+			if rl := ex.RateLimit(); rl != nil {
+				e.limit = rl
+			}
+		})
+		return err
+	}
+}
+
+// update calls f with the stats for the given endpoint, while holding the
+// lock. The stats are created if necessary.
+func (c *Collector) update(key string, f func(*endpoint)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.stats[key]
+	if !ok {
+		if c.stats == nil {
+			c.stats = make(map[string]*endpoint)
+		}
+		bounds := c.Buckets
+		if len(bounds) == 0 {
+			bounds = DefaultBuckets
+		}
+		e = &endpoint{
+			errors:  make(map[int]int64),
+			latency: histogram{bounds: bounds, counts: make([]int64, len(bounds))},
+		}
+		c.stats[key] = e
+	}
+	f(e)
+}
+
+// Stats is a snapshot of the metrics recorded for one endpoint.
+type Stats struct {
+	// The number of requests issued.
+	Requests int64 `json:"requests"`
+
+	// The number of errors, by HTTP status. Errors that do not have an HTTP
+	// status, such as network errors, are counted under status 0.
+	Errors map[int]int64 `json:"errors,omitempty"`
+
+	// The number of response body bytes received.
+	Bytes int64 `json:"bytes"`
+
+	// The latency of calls to the endpoint.
+	Latency *Histogram `json:"latency,omitempty"`
+
+	// The rate limit most recently reported by the server, or nil.
+	RateLimit *twitter.RateLimit `json:"rate_limit,omitempty"`
+
+	// The number of stream messages received.
+	Messages int64 `json:"messages,omitempty"`
+
+	// The average number of stream messages received per second over the
+	// last RateWindow.
+	MessageRate float64 `json:"message_rate,omitempty"`
+}
+
+// A Histogram records the distribution of a set of observations.
+type Histogram struct {
+	// The upper bounds of the buckets, in increasing order.
+	Buckets []float64 `json:"buckets"`
+
+	// Counts[i] is the number of observations less than or equal to
+	// Buckets[i]. Counts are cumulative, as in Prometheus.
+	Counts []int64 `json:"counts"`
+
+	Count int64   `json:"count"` // the total number of observations
+	Sum   float64 `json:"sum"`   // the sum of all observations
+}
+
+// Stats returns a snapshot of the metrics recorded by c, keyed by endpoint.
+func (c *Collector) Stats() map[string]*Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	out := make(map[string]*Stats, len(c.stats))
+	for key, e := range c.stats {
+		s := &Stats{
+			Requests: e.requests,
+			Bytes:    e.bytes,
+			Messages: e.messages,
+		}
+		if len(e.errors) != 0 {
+			s.Errors = make(map[int]int64, len(e.errors))
+			for status, n := range e.errors {
+				s.Errors[status] = n
+			}
+		}
+		if e.latency.count != 0 {
+			s.Latency = e.latency.snapshot()
+		}
+		if e.limit != nil {
+			cp := *e.limit
+			s.RateLimit = &cp
+		}
+		if e.messages != 0 {
+			s.MessageRate = e.window.rate(now)
+		}
+		out[key] = s
+	}
+	return out
+}
+
+// Publish publishes the metrics of c as an expvar with the given name.
+// Like expvar.Publish, it panics if the name is already in use.
+func (c *Collector) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return c.Stats() }))
+}
+
+// ServeHTTP implements the http.Handler interface. It serves the metrics of c
+// in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteText(w)
+}
+
+// WriteText writes the metrics of c to w in the Prometheus text exposition
+// format.
+func (c *Collector) WriteText(w io.Writer) error {
+	stats := c.Stats()
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	family := func(name, kind, help string, each func(key string, s *Stats)) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, key := range keys {
+			each(key, stats[key])
+		}
+	}
+	sample := func(name string, value float64, labels ...string) {
+		buf.WriteString(name)
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i == 0 {
+				buf.WriteByte('{')
+			} else {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, "%s=%s", labels[i], quoteLabel(labels[i+1]))
+		}
+		if len(labels) != 0 {
+			buf.WriteByte('}')
+		}
+		fmt.Fprintf(&buf, " %s\n", formatValue(value))
+	}
+
+	family("twitter_requests_total", "counter", "Requests issued, by endpoint.", func(key string, s *Stats) {
+		sample("twitter_requests_total", float64(s.Requests), "endpoint", key)
+	})
+	family("twitter_errors_total", "counter", "Failed requests, by endpoint and HTTP status.", func(key string, s *Stats) {
+		codes := make([]int, 0, len(s.Errors))
+		for code := range s.Errors {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			sample("twitter_errors_total", float64(s.Errors[code]),
+				"endpoint", key, "status", strconv.Itoa(code))
+		}
+	})
+	family("twitter_request_duration_seconds", "histogram", "Latency of completed calls, by endpoint.", func(key string, s *Stats) {
+		h := s.Latency
+		if h == nil {
+			return
+		}
+		for i, le := range h.Buckets {
+			sample("twitter_request_duration_seconds_bucket", float64(h.Counts[i]),
+				"endpoint", key, "le", formatValue(le))
+		}
+		sample("twitter_request_duration_seconds_bucket", float64(h.Count), "endpoint", key, "le", "+Inf")
+		sample("twitter_request_duration_seconds_sum", h.Sum, "endpoint", key)
+		sample("twitter_request_duration_seconds_count", float64(h.Count), "endpoint", key)
+	})
+	family("twitter_response_bytes_total", "counter", "Response body bytes received, by endpoint.", func(key string, s *Stats) {
+		sample("twitter_response_bytes_total", float64(s.Bytes), "endpoint", key)
+	})
+	family("twitter_rate_limit_remaining", "gauge", "Requests remaining in the current rate limit window, by endpoint.", func(key string, s *Stats) {
+		if s.RateLimit != nil {
+			sample("twitter_rate_limit_remaining", float64(s.RateLimit.Remaining), "endpoint", key)
+		}
+	})
+	family("twitter_rate_limit_ceiling", "gauge", "Requests allowed per rate limit window, by endpoint.", func(key string, s *Stats) {
+		if s.RateLimit != nil {
+			sample("twitter_rate_limit_ceiling", float64(s.RateLimit.Ceiling), "endpoint", key)
+		}
+	})
+	family("twitter_rate_limit_reset_seconds", "gauge", "Unix time when the current rate limit window resets, by endpoint.", func(key string, s *Stats) {
+		if s.RateLimit != nil && !s.RateLimit.Reset.IsZero() {
+			sample("twitter_rate_limit_reset_seconds", float64(s.RateLimit.Reset.Unix()), "endpoint", key)
+		}
+	})
+	family("twitter_stream_messages_total", "counter", "Stream messages received, by endpoint.", func(key string, s *Stats) {
+		if s.Messages != 0 {
+			sample("twitter_stream_messages_total", float64(s.Messages), "endpoint", key)
+		}
+	})
+	family("twitter_stream_messages_per_second", "gauge", "Average rate of stream messages over the last minute, by endpoint.", func(key string, s *Stats) {
+		if s.Messages != 0 {
+			sample("twitter_stream_messages_per_second", s.MessageRate, "endpoint", key)
+		}
+	})
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func quoteLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func formatValue(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+
+// endpoint holds the metrics for a single endpoint.
+type endpoint struct {
+	requests int64
+	errors   map[int]int64
+	bytes    int64
+	latency  histogram
+	limit    *twitter.RateLimit
+	messages int64
+	window   rateWindow
+}
+
+type histogram struct {
+	bounds []float64
+	counts []int64 // counts[i] is the number of observations in bucket i
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) snapshot() *Histogram {
+	out := &Histogram{
+		Buckets: append([]float64(nil), h.bounds...),
+		Counts:  make([]int64, len(h.counts)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	var sum int64
+	for i, n := range h.counts {
+		sum += n
+		out.Counts[i] = sum
+	}
+	return out
+}
+
+const windowSlots = int64(RateWindow / time.Second)
+
+// A rateWindow counts events in one-second slots over the last RateWindow.
+type rateWindow struct {
+	slots [windowSlots]int64
+	first int64 // the Unix time of the first event
+	last  int64 // the Unix time of the most recent update
+}
+
+func (w *rateWindow) add(now time.Time) {
+	sec := now.Unix()
+	if w.first == 0 {
+		w.first, w.last = sec, sec
+	}
+	w.advance(sec)
+	w.slots[sec%windowSlots]++
+}
+
+// advance clears the slots for the seconds between the last update and sec.
+func (w *rateWindow) advance(sec int64) {
+	if sec-w.last >= windowSlots {
+		w.slots = [windowSlots]int64{}
+	} else {
+		for t := w.last + 1; t <= sec; t++ {
+			w.slots[t%windowSlots] = 0
+		}
+	}
+	if sec > w.last {
+		w.last = sec
+	}
+}
+
+// rate reports the average number of events per second over the window
+// ending at now, or since the first event if that is more recent.
+func (w *rateWindow) rate(now time.Time) float64 {
+	sec := now.Unix()
+	w.advance(sec)
+	var sum int64
+	for _, n := range w.slots {
+		sum += n
+	}
+	span := sec - w.first + 1
+	if span > windowSlots {
+		span = windowSlots
+	}
+	return float64(sum) / float64(span)
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package metrics_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/metrics"
+	"github.com/nankys/twitter/tweets"
+)
+
+func TestCollector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("x-rate-limit-limit", "300")
+		w.Header().Set("x-rate-limit-remaining", "297")
+		switch {
+		case req.URL.Path == "/2/tweets/search/stream":
+			for i := 1; i <= 3; i++ {
+				fmt.Fprintf(w, "{\"data\":{\"id\":\"%d\",\"text\":\"x\"}}\r\n", i)
+			}
+		case req.URL.Query().Get("ids") == "666":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"data":{"id":"1","text":"hello"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	m := &metrics.Collector{Buckets: []float64{1, 10}}
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+	cli.Interceptors = append(cli.Interceptors, m.Interceptor())
+
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "666"} {
+		tweets.Lookup(id, nil).Invoke(ctx, cli)
+	}
+	var nr int
+	if err := tweets.SearchStream(func(*tweets.Reply) error {
+		nr++
+		return nil
+	}, nil).Invoke(ctx, cli); err != nil {
+		t.Fatalf("SearchStream failed: %v", err)
+	}
+
+	stats := m.Stats()
+	lookup := stats["GET 2/tweets"]
+	if lookup == nil {
+		t.Fatalf("Missing lookup stats: %+v", stats)
+	}
+	if lookup.Requests != 3 || lookup.Errors[429] != 1 {
+		t.Errorf("Lookup: got %d requests, %v errors; want 3, 429:1", lookup.Requests, lookup.Errors)
+	}
+	if lookup.Latency == nil || lookup.Latency.Count != 3 || lookup.Latency.Counts[0] != 3 {
+		t.Errorf("Lookup latency: got %+v, want 3 observations under 1s", lookup.Latency)
+	}
+	if rl := lookup.RateLimit; rl == nil || rl.Remaining != 297 || rl.Ceiling != 300 {
+		t.Errorf("Lookup rate limit: got %+v, want 297 of 300", rl)
+	}
+	stream := stats["GET 2/tweets/search/stream"]
+	if stream == nil {
+		t.Fatalf("Missing stream stats: %+v", stats)
+	}
+	if stream.Requests != 1 || stream.Messages != 3 || stream.MessageRate <= 0 {
+		t.Errorf("Stream: got %d requests, %d messages at %g/s; want 1, 3 at >0/s",
+			stream.Requests, stream.Messages, stream.MessageRate)
+	}
+	if stream.Latency != nil {
+		t.Errorf("Stream latency: got %+v, want none", stream.Latency)
+	}
+
+	t.Run("Text", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		text := rec.Body.String()
+		for _, want := range []string{
+			"# TYPE twitter_requests_total counter\n",
+			`twitter_requests_total{endpoint="GET 2/tweets"} 3` + "\n",
+			`twitter_errors_total{endpoint="GET 2/tweets",status="429"} 1` + "\n",
+			`twitter_request_duration_seconds_bucket{endpoint="GET 2/tweets",le="1"} 3` + "\n",
+			`twitter_request_duration_seconds_bucket{endpoint="GET 2/tweets",le="+Inf"} 3` + "\n",
+			`twitter_request_duration_seconds_count{endpoint="GET 2/tweets"} 3` + "\n",
+			`twitter_rate_limit_remaining{endpoint="GET 2/tweets"} 297` + "\n",
+			`twitter_stream_messages_total{endpoint="GET 2/tweets/search/stream"} 3` + "\n",
+		} {
+			if !strings.Contains(text, want) {
+				t.Errorf("Metrics text is missing %q", want)
+			}
+		}
+		if t.Failed() {
+			t.Logf("Metrics text:\n%s", text)
+		}
+	})
+
+	t.Run("Expvar", func(t *testing.T) {
+		m.Publish("twitter_test")
+		var got map[string]*metrics.Stats
+		if err := json.Unmarshal([]byte(expvar.Get("twitter_test").String()), &got); err != nil {
+			t.Fatalf("Decoding expvar: %v", err)
+		}
+		if s := got["GET 2/tweets"]; s == nil || s.Requests != 3 {
+			t.Errorf("Expvar lookup stats: got %+v, want 3 requests", s)
+		}
+	})
+}
@@ -64,6 +64,21 @@ func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error)
 	return ocall.GetUsers(ctx, q.Request, q.opts, cli)
 }
 
+// FetchPage invokes the query to fetch the next page of results. The page
+// reply is a *Reply, and its items are *types.User values. This method
+// satisfies the twitter.Pageable interface.
+func (q Query) FetchPage(ctx context.Context, cli *twitter.Client) (*twitter.Page, error) {
+	rsp, err := q.Invoke(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, len(rsp.Users))
+	for i, u := range rsp.Users {
+		items[i] = u
+	}
+	return &twitter.Page{Reply: rsp, Items: items}, nil
+}
+
 // ListOpts provides parameters for list queries.  A nil *ListOpts provides
 // zero values for all fields.
 type ListOpts struct {
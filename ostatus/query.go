@@ -269,13 +269,62 @@ func (o *TimelineOpts) addQueryParams(key string, q *TimelineQuery) {
 	}
 	if o.UntilID != "" {
 		q.Request.Params.Set("max_id", o.UntilID)
+		q.untilID = o.UntilID
 	}
 }
 
 // TimelineQuery is a query to fetch a timeline of tweets.
+//
+// The timeline API does not report page tokens. To fetch successive pages,
+// use FetchPage, which updates the max_id parameter of the query to select
+// tweets older than the oldest one on the previous page.
 type TimelineQuery struct {
 	*jhttp.Request
-	opts types.TweetFields
+	opts    types.TweetFields
+	untilID string // the original max_id, if any
+}
+
+// HasMorePages reports whether the query has more pages to fetch. This is true
+// for a freshly-constructed query, and for a query whose last page fetched by
+// FetchPage was not empty.
+func (o TimelineQuery) HasMorePages() bool {
+	v, ok := o.Request.Params["max_id"]
+	return !ok || v[0] != ""
+}
+
+// ResetPageToken resets the query to its original max_id parameter, so that
+// subsequently invoking the query will fetch the first page of results.
+func (o TimelineQuery) ResetPageToken() {
+	if o.untilID != "" {
+		o.Request.Params.Set("max_id", o.untilID)
+	} else {
+		o.Request.Params.Reset("max_id")
+	}
+}
+
+// FetchPage invokes the query to fetch the next page of results, and updates
+// the max_id parameter of the query to select older tweets. The page reply is
+// a *Reply, and its items are *types.Tweet values. This method satisfies the
+// twitter.Pageable interface.
+func (o TimelineQuery) FetchPage(ctx context.Context, cli *twitter.Client) (*twitter.Page, error) {
+	rsp, err := o.Invoke(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	var oldest uint64
+	items := make([]interface{}, len(rsp.Tweets))
+	for i, t := range rsp.Tweets {
+		items[i] = t
+		if id, err := strconv.ParseUint(t.ID, 10, 64); err == nil && (oldest == 0 || id < oldest) {
+			oldest = id
+		}
+	}
+	if oldest > 1 {
+		o.Request.Params.Set("max_id", strconv.FormatUint(oldest-1, 10))
+	} else {
+		o.Request.Params.Set("max_id", "") // no more pages
+	}
+	return &twitter.Page{Reply: rsp, Items: items}, nil
 }
 
 // Invoke posts the query and reports the matching tweets.
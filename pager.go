@@ -0,0 +1,139 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStopPaging is a sentinel error that a Pager callback can use to signal
+// it does not want any further results.
+var ErrStopPaging = errors.New("stop paging")
+
+// A Pageable is a query whose results can be fetched in successive pages.
+// The queries in packages tweets, users, lists, olists, and ostatus (for
+// timelines) satisfy this interface.
+type Pageable interface {
+	// HasMorePages reports whether the query has more pages to fetch.
+	HasMorePages() bool
+
+	// FetchPage fetches the next page of results, and updates the query so
+	// that calling FetchPage again will fetch the page after that.
+	FetchPage(ctx context.Context, cli *Client) (*Page, error)
+}
+
+// A Page is a single page of results from a Pageable query.
+type Page struct {
+	// The reply for this page. The concrete type depends on the query; for
+	// example, a tweets.Query reports a *tweets.Reply.
+	Reply interface{}
+
+	// The items on this page. The concrete type depends on the query; for
+	// example, a tweets.Query reports *types.Tweet values.
+	Items []interface{}
+}
+
+// PagerOpts provides limits for a Pager. A nil *PagerOpts provides zero values
+// for all fields.
+type PagerOpts struct {
+	// If positive, stop after this many pages have been fetched.
+	MaxPages int
+
+	// If positive, stop after this many items have been fetched.
+	MaxItems int
+}
+
+// A Pager iterates over the results of a Pageable query, page by page or item
+// by item. For example:
+//
+//	p := twitter.NewPager(users.FollowersOf(id, nil), &twitter.PagerOpts{
+//	   MaxItems: 5000,
+//	})
+//	err := p.EachItem(ctx, cli, func(v interface{}) error {
+//	   process(v.(*types.User))
+//	   return nil
+//	})
+//
+// A Pager advances the page token of its query as it goes, and its limits
+// apply across all calls to its methods.
+type Pager struct {
+	q        Pageable
+	maxPages int
+	maxItems int
+	pages    int // pages fetched so far
+	items    int // items on pages fetched so far
+}
+
+// NewPager constructs a Pager for the given query.
+func NewPager(q Pageable, opts *PagerOpts) *Pager {
+	p := &Pager{q: q}
+	if opts != nil {
+		p.maxPages = opts.MaxPages
+		p.maxItems = opts.MaxItems
+	}
+	return p
+}
+
+// Pages reports the number of pages fetched so far.
+func (p *Pager) Pages() int { return p.pages }
+
+// Items reports the number of items on the pages fetched so far, after
+// truncation to the item limit.
+func (p *Pager) Items() int { return p.items }
+
+// HasMorePages reports whether the pager has more pages to fetch, meaning the
+// query has more pages and the pager's limits have not been reached.
+func (p *Pager) HasMorePages() bool {
+	if p.maxPages > 0 && p.pages >= p.maxPages {
+		return false
+	} else if p.maxItems > 0 && p.items >= p.maxItems {
+		return false
+	}
+	return p.q.HasMorePages()
+}
+
+// EachPage fetches successive pages and calls f for each one, until there
+// are no more pages, the pager's limits are reached, or ctx ends. If the item
+// limit falls within a page, the items of that page are truncated.
+//
+// If f reports an error, iteration stops. If the error is ErrStopPaging,
+// EachPage returns nil; otherwise it returns the error from f.
+func (p *Pager) EachPage(ctx context.Context, cli *Client, f func(*Page) error) error {
+	for p.HasMorePages() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := p.q.FetchPage(ctx, cli)
+		if err != nil {
+			return err
+		}
+		p.pages++
+		if p.maxItems > 0 && p.items+len(page.Items) > p.maxItems {
+			page.Items = page.Items[:p.maxItems-p.items]
+		}
+		p.items += len(page.Items)
+		if err := f(page); errors.Is(err, ErrStopPaging) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EachItem fetches successive pages and calls f for each item they contain,
+// until there are no more pages, the pager's limits are reached, or ctx ends.
+//
+// If f reports an error, iteration stops. If the error is ErrStopPaging,
+// EachItem returns nil; otherwise it returns the error from f.
+func (p *Pager) EachItem(ctx context.Context, cli *Client, f func(interface{}) error) error {
+	return p.EachPage(ctx, cli, func(page *Page) error {
+		for _, item := range page.Items {
+			if err := f(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/ostatus"
+	"github.com/nankys/twitter/tweets"
+	"github.com/nankys/twitter/types"
+	"github.com/nankys/twitter/users"
+)
+
+// pagingServer serves numPages pages of two users each, using the given name
+// for the page token parameter.
+func pagingServer(t *testing.T, tokenParam string, numPages int) *twitter.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		page, _ := strconv.Atoi(req.URL.Query().Get(tokenParam))
+		var next string
+		if page+1 < numPages {
+			next = strconv.Itoa(page + 1)
+		}
+		fmt.Fprintf(w, `{"data":[{"id":"%d","text":"a"},{"id":"%d","text":"b"}],
+"meta":{"result_count":2,"next_token":%q}}`, 2*page+1, 2*page+2, next)
+	}))
+	t.Cleanup(srv.Close)
+	return twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+}
+
+func TestPager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Pages", func(t *testing.T) {
+		cli := pagingServer(t, "pagination_token", 3)
+		p := twitter.NewPager(users.FollowersOf("12", nil), nil)
+		var got []string
+		if err := p.EachPage(ctx, cli, func(page *twitter.Page) error {
+			for _, u := range page.Reply.(*users.Reply).Users {
+				got = append(got, u.ID)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("EachPage failed: %v", err)
+		}
+		if s := strings.Join(got, ","); s != "1,2,3,4,5,6" {
+			t.Errorf("EachPage: got IDs %s, want 1..6", s)
+		}
+		if p.Pages() != 3 || p.Items() != 6 {
+			t.Errorf("Pager: got %d pages, %d items; want 3, 6", p.Pages(), p.Items())
+		}
+	})
+
+	t.Run("MaxItems", func(t *testing.T) {
+		cli := pagingServer(t, "next_token", 5)
+		p := twitter.NewPager(tweets.SearchRecent("cat", nil), &twitter.PagerOpts{MaxItems: 3})
+		var got []string
+		if err := p.EachItem(ctx, cli, func(v interface{}) error {
+			got = append(got, v.(*types.Tweet).ID)
+			return nil
+		}); err != nil {
+			t.Fatalf("EachItem failed: %v", err)
+		}
+		if s := strings.Join(got, ","); s != "1,2,3" {
+			t.Errorf("EachItem: got IDs %s, want 1,2,3", s)
+		}
+	})
+
+	t.Run("MaxPages", func(t *testing.T) {
+		cli := pagingServer(t, "pagination_token", 5)
+		p := twitter.NewPager(tweets.FromUser("12", nil), &twitter.PagerOpts{MaxPages: 2})
+		if err := p.EachPage(ctx, cli, func(*twitter.Page) error { return nil }); err != nil {
+			t.Fatalf("EachPage failed: %v", err)
+		}
+		if p.Pages() != 2 {
+			t.Errorf("Pager: got %d pages, want 2", p.Pages())
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		cli := pagingServer(t, "pagination_token", 5)
+		p := twitter.NewPager(users.FollowedBy("12", nil), nil)
+		if err := p.EachItem(ctx, cli, func(v interface{}) error {
+			if v.(*types.User).ID == "3" {
+				return twitter.ErrStopPaging
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("EachItem failed: %v", err)
+		}
+		if p.Pages() != 2 {
+			t.Errorf("Pager: got %d pages, want 2", p.Pages())
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		cli := pagingServer(t, "pagination_token", 5)
+		ctx, cancel := context.WithCancel(ctx)
+		p := twitter.NewPager(users.FollowersOf("12", nil), nil)
+		err := p.EachPage(ctx, cli, func(*twitter.Page) error {
+			cancel()
+			return nil
+		})
+		if err != context.Canceled {
+			t.Errorf("EachPage: got error %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestTimelinePager(t *testing.T) {
+	// Serve a timeline of tweets with IDs 10 down to 1, in pages of 4.
+	var maxIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		maxID := req.URL.Query().Get("max_id")
+		maxIDs = append(maxIDs, maxID)
+		top := 10
+		if maxID != "" {
+			top, _ = strconv.Atoi(maxID)
+		}
+		var out []string
+		for id := top; id > 0 && id > top-4; id-- {
+			out = append(out, fmt.Sprintf(`{"id_str":"%d","full_text":"tweet %d"}`, id, id))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(out, ","))
+	}))
+	defer srv.Close()
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+	q := ostatus.UserTimeline("jack", nil)
+	var got []string
+	if err := twitter.NewPager(q, nil).EachItem(context.Background(), cli, func(v interface{}) error {
+		got = append(got, v.(*types.Tweet).ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachItem failed: %v", err)
+	}
+	if s := strings.Join(got, ","); s != "10,9,8,7,6,5,4,3,2,1" {
+		t.Errorf("Timeline: got IDs %s, want 10..1", s)
+	}
+	if s := strings.Join(maxIDs, ","); s != ",6,2" {
+		t.Errorf("Timeline: got max_id values %q, want %q", s, ",6,2")
+	}
+	if q.HasMorePages() {
+		t.Error("Timeline: HasMorePages is true after the last page")
+	}
+	q.ResetPageToken()
+	if !q.HasMorePages() {
+		t.Error("Timeline: HasMorePages is false after reset")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A Distance is a length used by geo operators, in miles or kilometers.
+type Distance struct {
+	value float64
+	km    bool
+}
+
+// Miles returns a Distance of v miles.
+func Miles(v float64) Distance { return Distance{value: v} }
+
+// Kilometers returns a Distance of v kilometers.
+func Kilometers(v float64) Distance { return Distance{value: v, km: true} }
+
+// String renders d as used in a query, for example "10mi" or "16km".
+func (d Distance) String() string {
+	if d.km {
+		return formatFloat(d.value) + "km"
+	}
+	return formatFloat(d.value) + "mi"
+}
+
+// miles returns the length of d in miles.
+func (d Distance) miles() float64 {
+	if d.km {
+		return d.value / kmPerMile
+	}
+	return d.value
+}
+
+const (
+	kmPerMile    = 1.609344
+	earthRadius  = 3958.8 // mean radius, in miles
+	maxGeoMiles  = 25     // the limit on radius and box sides, in miles
+	maxGeoKM     = 40     // the limit on radius and box sides, in kilometers
+	maxPlaceName = 256
+)
+
+// Place matches tweets tagged with the specified place, given by name or
+// place ID. Names containing spaces are quoted.
+func (Builder) Place(s string) Query {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return invalid{term: "place:", err: errors.New("empty place name")}
+	case len(s) > maxPlaceName || strings.Contains(s, `"`):
+		return invalid{term: "place:" + s, err: errors.New("invalid place name")}
+	case strings.ContainsAny(s, " \t"):
+		return quoted{tag: "place:", arg: s}
+	}
+	return solo("place:" + s)
+}
+
+// PlaceCountry matches tweets tagged with a place in the country with the
+// specified ISO 3166-1 alpha-2 code, such as "US" or "GB".
+func (Builder) PlaceCountry(code string) Query {
+	term := "place_country:" + strings.ToUpper(code)
+	if err := checkCountry(code); err != nil {
+		return invalid{term: term, err: err}
+	}
+	return solo(term)
+}
+
+// PointRadius matches tweets tagged with a location, or with a place whose
+// geometry intersects a location, within radius of the point with the given
+// longitude and latitude in degrees. The radius may not exceed 25 miles (or
+// 40 kilometers).
+func (Builder) PointRadius(lon, lat float64, radius Distance) Query {
+	term := fmt.Sprintf("point_radius:[%s %s %s]", formatFloat(lon), formatFloat(lat), radius)
+	if err := checkPointRadius(lon, lat, radius); err != nil {
+		return invalid{term: term, err: err}
+	}
+	return solo(term)
+}
+
+// BoundingBox matches tweets tagged with a location, or with a place whose
+// geometry is fully contained, within the box with the given west and east
+// longitudes and south and north latitudes in degrees. Neither the width nor
+// the height of the box may exceed 25 miles.
+func (Builder) BoundingBox(west, south, east, north float64) Query {
+	term := fmt.Sprintf("bounding_box:[%s %s %s %s]",
+		formatFloat(west), formatFloat(south), formatFloat(east), formatFloat(north))
+	if err := checkBoundingBox(west, south, east, north); err != nil {
+		return invalid{term: term, err: err}
+	}
+	return solo(term)
+}
+
+// HasGeo matches tweets that have geolocation data, either a location or a
+// place.
+func (Builder) HasGeo() Query { return nsolo("has:geo") }
+
+// An invalid query is a term that could not be constructed correctly. It
+// renders as the term would have, but is never valid, and the error is
+// reported by Validate and Compile.
+type invalid struct {
+	term string
+	err  error
+}
+
+func (q invalid) String() string { return q.term }
+func (invalid) Valid() bool      { return false }
+
+func checkCountry(code string) error {
+	if len(code) != 2 || !isLetter(code[0]) || !isLetter(code[1]) {
+		return fmt.Errorf("invalid country code %q", code)
+	}
+	return nil
+}
+
+func isLetter(b byte) bool { return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') }
+
+func checkPoint(lon, lat float64) error {
+	if math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return fmt.Errorf("longitude %v out of range [-180, 180]", lon)
+	} else if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude %v out of range [-90, 90]", lat)
+	}
+	return nil
+}
+
+func checkPointRadius(lon, lat float64, radius Distance) error {
+	if err := checkPoint(lon, lat); err != nil {
+		return err
+	}
+	if !(radius.value > 0) {
+		return fmt.Errorf("radius %s must be positive", radius)
+	} else if radius.km && radius.value > maxGeoKM {
+		return fmt.Errorf("radius %s exceeds the limit of %dkm", radius, maxGeoKM)
+	} else if !radius.km && radius.value > maxGeoMiles {
+		return fmt.Errorf("radius %s exceeds the limit of %dmi", radius, maxGeoMiles)
+	}
+	return nil
+}
+
+func checkBoundingBox(west, south, east, north float64) error {
+	if err := checkPoint(west, south); err != nil {
+		return err
+	} else if err := checkPoint(east, north); err != nil {
+		return err
+	} else if west >= east {
+		return fmt.Errorf("west longitude %v is not less than east longitude %v", west, east)
+	} else if south >= north {
+		return fmt.Errorf("south latitude %v is not less than north latitude %v", south, north)
+	}
+
+	// The box is widest along the latitude nearest the equator.
+	wlat := math.Min(math.Abs(south), math.Abs(north))
+	if south < 0 && north > 0 {
+		wlat = 0
+	}
+	if w := haversine(west, wlat, east, wlat); w > maxGeoMiles {
+		return fmt.Errorf("box width %.1fmi exceeds the limit of %dmi", w, maxGeoMiles)
+	} else if h := haversine(west, south, west, north); h > maxGeoMiles {
+		return fmt.Errorf("box height %.1fmi exceeds the limit of %dmi", h, maxGeoMiles)
+	}
+	return nil
+}
+
+// parseGeoValue parses and checks the bracketed value of a point_radius: or
+// bounding_box: operator. For point_radius:, it returns the longitude,
+// latitude, and radius in miles; for bounding_box:, it returns the west,
+// south, east, and north bounds.
+func parseGeoValue(op, arg string) ([]float64, error) {
+	if !strings.HasPrefix(arg, "[") || !strings.HasSuffix(arg, "]") {
+		return nil, errors.New("value must be a bracketed list")
+	}
+	fields := strings.Fields(arg[1 : len(arg)-1])
+	switch op {
+	case "point_radius":
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("want [lon lat radius], got %d values", len(fields))
+		}
+		pt, err := parseFloats(fields[:2])
+		if err != nil {
+			return nil, err
+		}
+		d, err := parseDistance(fields[2])
+		if err != nil {
+			return nil, err
+		} else if err := checkPointRadius(pt[0], pt[1], d); err != nil {
+			return nil, err
+		}
+		return append(pt, d.miles()), nil
+	case "bounding_box":
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("want [west south east north], got %d values", len(fields))
+		}
+		box, err := parseFloats(fields)
+		if err != nil {
+			return nil, err
+		} else if err := checkBoundingBox(box[0], box[1], box[2], box[3]); err != nil {
+			return nil, err
+		}
+		return box, nil
+	}
+	return nil, fmt.Errorf("operator %q does not take a geo value", op+":")
+}
+
+func parseFloats(ss []string) ([]float64, error) {
+	out := make([]float64, len(ss))
+	for i, s := range ss {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", s)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func parseDistance(s string) (Distance, error) {
+	var km bool
+	if t := strings.TrimSuffix(s, "km"); t != s {
+		s, km = t, true
+	} else if t := strings.TrimSuffix(s, "mi"); t != s {
+		s = t
+	} else {
+		return Distance{}, fmt.Errorf("radius %q must have units mi or km", s)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Distance{}, fmt.Errorf("invalid radius %q", s)
+	}
+	return Distance{value: v, km: km}, nil
+}
+
+// haversine returns the great-circle distance in miles between two points
+// given as longitude and latitude in degrees.
+func haversine(lon1, lat1, lon2, lat2 float64) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	dlat, dlon := rad(lat2-lat1), rad(lon2-lon1)
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
@@ -0,0 +1,122 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/types"
+)
+
+func TestGeo(t *testing.T) {
+	b := query.New()
+	tests := []struct {
+		q     query.Query
+		want  string
+		valid bool
+	}{
+		{b.Place("Paris"), "place:Paris", true},
+		{b.Place(" new york city "), `place:"new york city"`, true},
+		{b.PlaceCountry("gb"), "place_country:GB", true},
+		{b.PointRadius(2.355128, 48.861118, query.Kilometers(16)), "point_radius:[2.355128 48.861118 16km]", true},
+		{b.PointRadius(-105.27, 40.01, query.Miles(10)), "point_radius:[-105.27 40.01 10mi]", true},
+		{b.BoundingBox(-105.3, 39.9, -105.1, 40.1), "bounding_box:[-105.3 39.9 -105.1 40.1]", true},
+		{b.HasGeo(), "has:geo", false},
+
+		{b.Place(""), "place:", false},
+		{b.PlaceCountry("GBR"), "place_country:GBR", false},
+		{b.PointRadius(0, 0, query.Miles(26)), "point_radius:[0 0 26mi]", false},
+		{b.PointRadius(0, 0, query.Kilometers(41)), "point_radius:[0 0 41km]", false},
+		{b.PointRadius(0, 0, query.Miles(0)), "point_radius:[0 0 0mi]", false},
+		{b.PointRadius(181, 0, query.Miles(1)), "point_radius:[181 0 1mi]", false},
+		{b.BoundingBox(-106, 39, -105, 40), "bounding_box:[-106 39 -105 40]", false},
+		{b.BoundingBox(1, 1, 0, 2), "bounding_box:[1 1 0 2]", false},
+	}
+	for _, test := range tests {
+		if got := test.q.String(); got != test.want {
+			t.Errorf("String: got %q, want %q", got, test.want)
+		}
+		if got := test.q.Valid(); got != test.valid {
+			t.Errorf("%s: Valid: got %v, want %v", test.want, got, test.valid)
+		}
+		err := query.Validate(b.And(test.q, b.Word("cat")), query.Elevated)
+		if test.valid && err != nil {
+			t.Errorf("Validate(%s): unexpected error: %v", test.want, err)
+		} else if !test.valid && test.want != "has:geo" {
+			if err == nil {
+				t.Errorf("Validate(%s): got nil, want error", test.want)
+			}
+			if _, err := query.Compile(test.q); err == nil {
+				t.Errorf("Compile(%s): got nil, want error", test.want)
+			}
+		}
+	}
+
+	// Geo values in query strings are checked too.
+	for input, ok := range map[string]bool{
+		"point_radius:[2.355128 48.861118 16km]": true,
+		"point_radius:[2.355128 48.861118 50km]": false,
+		"point_radius:[2.355128 48.861118 16]":   false,
+		"point_radius:[2.355128 16km]":           false,
+		"bounding_box:[-105.3 39.9 -105.1 40.1]": true,
+		"bounding_box:[-105.3 39.9 -104 40.1]":   false,
+		"bounding_box:[a b c d]":                 false,
+		"place_country:US":                       true,
+		"place_country:USA":                      false,
+	} {
+		if err := query.ValidateString(input, query.Elevated); (err == nil) != ok {
+			t.Errorf("ValidateString(%q): got %v, want ok=%v", input, err, ok)
+		}
+	}
+}
+
+func TestMatchGeo(t *testing.T) {
+	inc := &query.Includes{
+		Places: types.Places{{
+			ID: "p1", Name: "Boulder", FullName: "Boulder, CO", CountryCode: "US",
+			Location: json.RawMessage(`{"type":"Feature","bbox":[-105.30,39.96,-105.18,40.09],"properties":{}}`),
+		}},
+	}
+	tweets := map[string]*types.Tweet{
+		"point": {ID: "1", Text: "here", Location: &types.Location{
+			Coordinates: json.RawMessage(`{"type":"Point","coordinates":[2.3522,48.8566]}`),
+		}},
+		"place": {ID: "2", Text: "there", Location: &types.Location{PlaceID: "p1"}},
+		"none":  {ID: "3", Text: "nowhere"},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"place:boulder", []string{"place"}},
+		{`place:"boulder, co"`, []string{"place"}},
+		{"place:p1", []string{"place"}},
+		{"place_country:us", []string{"place"}},
+		{"point_radius:[2.355128 48.861118 1mi]", []string{"point"}},
+		{"point_radius:[2.4 48.9 1km]", nil},
+		{"point_radius:[-105.1 40 10mi]", []string{"place"}},
+		{"bounding_box:[2.3 48.8 2.4 48.9]", []string{"point"}},
+		{"bounding_box:[-105.35 39.9 -105.1 40.1]", []string{"place"}},
+		{"bounding_box:[-105.25 39.9 -105.1 40.1]", nil},
+		{"here OR there has:geo", []string{"point", "place"}},
+	}
+	names := []string{"point", "place", "none"}
+	for _, test := range tests {
+		m, err := query.CompileString(test.query)
+		if err != nil {
+			t.Errorf("CompileString(%q): unexpected error: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, name := range names {
+			if m.Match(tweets[name], inc) {
+				got = append(got, name)
+			}
+		}
+		if !equalStrings(got, test.want) {
+			t.Errorf("Query %q: matched %q, want %q", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,605 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/nankys/twitter/types"
+)
+
+// Includes carries the objects referenced by the tweets being matched, such
+// as their authors, as reported in the includes of a reply. Operators that
+// depend on these objects, such as from: or has:images, do not match if the
+// objects they need are missing.
+type Includes struct {
+	Users  types.Users
+	Tweets types.Tweets
+	Media  types.Medias
+	Places types.Places
+}
+
+// NewIncludes decodes the includes of a reply, as reported in the Includes
+// field of a twitter.Reply. Kinds of objects that are not used for matching
+// are ignored.
+func NewIncludes(includes map[string]json.RawMessage) (*Includes, error) {
+	var inc Includes
+	for _, kind := range []struct {
+		key string
+		v   interface{}
+	}{
+		{"users", &inc.Users},
+		{"tweets", &inc.Tweets},
+		{"media", &inc.Media},
+		{"places", &inc.Places},
+	} {
+		if data := includes[kind.key]; len(data) != 0 {
+			if err := json.Unmarshal(data, kind.v); err != nil {
+				return nil, fmt.Errorf("decoding included %s: %w", kind.key, err)
+			}
+		}
+	}
+	return &inc, nil
+}
+
+func (inc *Includes) user(id string) *types.User {
+	if inc != nil && id != "" {
+		for _, u := range inc.Users {
+			if u.ID == id {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+func (inc *Includes) tweet(id string) *types.Tweet {
+	if inc != nil && id != "" {
+		for _, t := range inc.Tweets {
+			if t.ID == id {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+func (inc *Includes) media(key string) *types.Media {
+	if inc != nil {
+		for _, m := range inc.Media {
+			if m.Key == key {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func (inc *Includes) place(id string) *types.Place {
+	if inc != nil && id != "" {
+		for _, p := range inc.Places {
+			if p.ID == id {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// A Matcher evaluates a query against tweets, without consulting the API.
+//
+// Keywords and phrases match the text of a tweet by tokens, ignoring case and
+// punctuation, so the keyword "cat" matches "Cat!" but not "cats". Matching
+// is an approximation of the behavior of the service, which applies rules
+// (such as stemming and URL expansion) that are not reproduced here.
+//
+// The supported operators are keywords, quoted phrases, #hashtag, @mention,
+// $cashtag, from:, to:, url:, retweets_of:, retweets_of_tweet_id:,
+// quotes_of_tweet_id:, in_reply_to_tweet_id:, conversation_id:, lang:,
+// entity:, context:, place:, place_country:, point_radius:, bounding_box:,
+// bio:, bio_name:, bio_location:, followers_count:, following_count:,
+// tweets_count:, listed_count:, is:retweet, is:reply, is:quote, is:verified,
+// and has:hashtags, has:cashtags, has:links, has:mentions, has:media,
+// has:images, has:videos, and has:geo. Operators that depend on data not
+// present in a tweet, such as list: and sample:, are not supported.
+//
+// The bio and count operators require the author of the tweet in the
+// includes, with its description, location, and public metrics.
+type Matcher struct {
+	match predicate
+}
+
+// A predicate reports whether a tweet satisfies a query.
+type predicate func(*subject) bool
+
+// Compile compiles q into a Matcher. It reports an error if q contains an
+// operator that cannot be evaluated offline.
+func Compile(q Query) (*Matcher, error) {
+	p, err := compileQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{match: p}, nil
+}
+
+// CompileString parses a search query or rule string and compiles it into a
+// Matcher.
+func CompileString(s string) (*Matcher, error) {
+	q, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(q)
+}
+
+// Match reports whether t matches the query. Objects referenced by t are
+// resolved from inc, which may be nil.
+func (m *Matcher) Match(t *types.Tweet, inc *Includes) bool {
+	return m.match(&subject{Tweet: t, inc: inc})
+}
+
+// Match reports whether t matches q. Objects referenced by t are resolved
+// from inc, which may be nil. This is a convenience wrapper for Compile; use
+// a Matcher to match many tweets against the same query.
+func Match(q Query, t *types.Tweet, inc *Includes) (bool, error) {
+	m, err := Compile(q)
+	if err != nil {
+		return false, err
+	}
+	return m.Match(t, inc), nil
+}
+
+// A subject is a tweet being matched, with its includes.
+type subject struct {
+	*types.Tweet
+	inc    *Includes
+	tokens []string // lazily populated, see words
+}
+
+// words returns the normalized tokens of the text of the tweet.
+func (s *subject) words() []string {
+	if s.tokens == nil {
+		s.tokens = tokens(s.Text)
+	}
+	return s.tokens
+}
+
+func (s *subject) author() *types.User { return s.inc.user(s.AuthorID) }
+
+func (s *subject) hasRef(kind string) bool {
+	for _, r := range s.Referenced {
+		if r.Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *subject) refersTo(kind, id string) bool {
+	for _, r := range s.Referenced {
+		if r.Type == kind && r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// place returns the place the tweet is tagged with, or nil.
+func (s *subject) place() *types.Place {
+	if s.Location == nil {
+		return nil
+	}
+	return s.inc.place(s.Location.PlaceID)
+}
+
+// point returns the coordinates of the tweet, if it has them.
+func (s *subject) point() (lon, lat float64, ok bool) {
+	if s.Location == nil || len(s.Location.Coordinates) == 0 {
+		return 0, 0, false
+	}
+	var pt struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	}
+	if json.Unmarshal(s.Location.Coordinates, &pt) != nil || pt.Type != "Point" || len(pt.Coordinates) != 2 {
+		return 0, 0, false
+	}
+	return pt.Coordinates[0], pt.Coordinates[1], true
+}
+
+// placeBox returns the bounding box of the place the tweet is tagged with,
+// if it has one.
+func (s *subject) placeBox() ([]float64, bool) {
+	p := s.place()
+	if p == nil || len(p.Location) == 0 {
+		return nil, false
+	}
+	var geo struct {
+		BBox []float64 `json:"bbox"`
+	}
+	if json.Unmarshal(p.Location, &geo) != nil || len(geo.BBox) != 4 {
+		return nil, false
+	}
+	return geo.BBox, true
+}
+
+func (s *subject) hasMedia(keep func(*types.Media) bool) bool {
+	for _, key := range s.Attachments["media_keys"] {
+		if m := s.inc.media(key); m != nil && keep(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileQuery(q Query) (predicate, error) {
+	switch t := q.(type) {
+	case andQuery:
+		ps, err := compileAll(t)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *subject) bool {
+			for _, p := range ps {
+				if !p(s) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case orQuery:
+		ps, err := compileAll(t)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *subject) bool {
+			for _, p := range ps {
+				if p(s) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case notQuery:
+		p, err := compileQuery(t.sub)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *subject) bool { return !p(s) }, nil
+	case solo:
+		return compileTerm(string(t))
+	case nsolo:
+		return compileTerm(string(t))
+	case invalid:
+		return nil, fmt.Errorf("invalid term %s: %w", t.term, t.err)
+	case quoted:
+		if t.tag == "" {
+			return phrase(t.arg), nil
+		}
+		return compileOp(strings.TrimSuffix(t.tag, ":"), t.arg)
+	default:
+		// A Query implemented outside this package. Parse its string form.
+		pq, err := Parse(q.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid query %q: %w", q.String(), err)
+		}
+		return compileQuery(pq)
+	}
+}
+
+func compileAll(qs []Query) ([]predicate, error) {
+	ps := make([]predicate, len(qs))
+	for i, q := range qs {
+		p, err := compileQuery(q)
+		if err != nil {
+			return nil, err
+		}
+		ps[i] = p
+	}
+	return ps, nil
+}
+
+// compileTerm compiles a single unquoted term.
+func compileTerm(term string) (predicate, error) {
+	switch {
+	case strings.HasPrefix(term, "#") && len(term) > 1:
+		return entityTag(term[1:], "#", func(e *types.Entities) []*types.Tag { return e.HashTags }), nil
+	case strings.HasPrefix(term, "$") && len(term) > 1:
+		return entityTag(term[1:], "$", func(e *types.Entities) []*types.Tag { return e.CashTags }), nil
+	case strings.HasPrefix(term, "@") && len(term) > 1:
+		return mention(term[1:]), nil
+	}
+	if op, arg := splitTerm(term); op != "" {
+		return compileOp(op, strings.Trim(arg, `"`))
+	}
+	return phrase(term), nil
+}
+
+// compileOp compiles an operator:value pair.
+func compileOp(op, arg string) (predicate, error) {
+	unsupported := fmt.Errorf("unsupported operator %s:%s", op, arg)
+	switch op {
+	case "from":
+		return func(s *subject) bool { return isUser(s.author(), s.AuthorID, arg) }, nil
+	case "to":
+		return func(s *subject) bool {
+			return s.InReplyTo != "" && isUser(s.inc.user(s.InReplyTo), s.InReplyTo, arg)
+		}, nil
+	case "retweets_of":
+		return func(s *subject) bool {
+			for _, r := range s.Referenced {
+				if r.Type != "retweeted" {
+					continue
+				}
+				if rt := s.inc.tweet(r.ID); rt != nil && isUser(s.inc.user(rt.AuthorID), rt.AuthorID, arg) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "url":
+		want := strings.ToLower(arg)
+		return func(s *subject) bool {
+			if s.Entities != nil {
+				for _, u := range s.Entities.URLs {
+					for _, v := range []string{u.URL, u.Expanded, u.Display, u.Unwound} {
+						if v != "" && strings.Contains(strings.ToLower(v), want) {
+							return true
+						}
+					}
+				}
+			}
+			return strings.Contains(strings.ToLower(s.Text), want)
+		}, nil
+	case "retweets_of_tweet_id":
+		return func(s *subject) bool { return s.refersTo("retweeted", arg) }, nil
+	case "quotes_of_tweet_id":
+		return func(s *subject) bool { return s.refersTo("quoted", arg) }, nil
+	case "in_reply_to_tweet_id":
+		return func(s *subject) bool { return s.refersTo("replied_to", arg) }, nil
+	case "conversation_id":
+		return func(s *subject) bool { return s.ConversationID == arg }, nil
+	case "bio", "bio_name", "bio_location":
+		want := tokens(arg)
+		return func(s *subject) bool {
+			u := s.author()
+			if u == nil {
+				return false
+			}
+			field := map[string]string{
+				"bio": u.Description, "bio_name": u.Name, "bio_location": u.FuzzyLocation,
+			}[op]
+			return containsSeq(tokens(field), want)
+		}, nil
+	case "followers_count", "following_count", "tweets_count", "listed_count":
+		lo, hi, err := parseCount(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid term %s:%s: %w", op, arg, err)
+		}
+		metric := op
+		if op == "tweets_count" {
+			metric = types.Metric_TweetCount
+		}
+		return func(s *subject) bool {
+			u := s.author()
+			if u == nil {
+				return false
+			}
+			n, ok := u.PublicMetrics[metric]
+			return ok && n >= lo && (hi < 0 || n <= hi)
+		}, nil
+	case "lang":
+		return func(s *subject) bool { return strings.EqualFold(s.Language, arg) }, nil
+	case "entity":
+		return func(s *subject) bool {
+			for _, ca := range s.ContextAnnotations {
+				if ca.Entity != nil && strings.EqualFold(ca.Entity.Name, arg) {
+					return true
+				}
+			}
+			if s.Entities != nil {
+				for _, a := range s.Entities.Annotations {
+					if strings.EqualFold(a.NormalizedText, arg) {
+						return true
+					}
+				}
+			}
+			return false
+		}, nil
+	case "context":
+		domain, entity := arg, ""
+		if i := strings.Index(arg, "."); i >= 0 {
+			domain, entity = arg[:i], arg[i+1:]
+		}
+		return func(s *subject) bool {
+			for _, ca := range s.ContextAnnotations {
+				if ca.Domain == nil || ca.Domain.ID != domain {
+					continue
+				}
+				if entity == "*" || (ca.Entity != nil && ca.Entity.ID == entity) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "place":
+		return func(s *subject) bool {
+			p := s.place()
+			return p != nil && (p.ID == arg || strings.EqualFold(p.Name, arg) ||
+				strings.Contains(strings.ToLower(p.FullName), strings.ToLower(arg)))
+		}, nil
+	case "place_country":
+		return func(s *subject) bool {
+			p := s.place()
+			return p != nil && strings.EqualFold(p.CountryCode, arg)
+		}, nil
+	case "point_radius":
+		v, err := parseGeoValue(op, arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid term %s:%s: %w", op, arg, err)
+		}
+		return func(s *subject) bool {
+			if lon, lat, ok := s.point(); ok {
+				return haversine(v[0], v[1], lon, lat) <= v[2]
+			} else if box, ok := s.placeBox(); ok {
+				// Measure to the nearest point of the box.
+				lon := math.Max(box[0], math.Min(v[0], box[2]))
+				lat := math.Max(box[1], math.Min(v[1], box[3]))
+				return haversine(v[0], v[1], lon, lat) <= v[2]
+			}
+			return false
+		}, nil
+	case "bounding_box":
+		v, err := parseGeoValue(op, arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid term %s:%s: %w", op, arg, err)
+		}
+		inBox := func(lon, lat float64) bool {
+			return v[0] <= lon && lon <= v[2] && v[1] <= lat && lat <= v[3]
+		}
+		return func(s *subject) bool {
+			if lon, lat, ok := s.point(); ok {
+				return inBox(lon, lat)
+			} else if box, ok := s.placeBox(); ok {
+				return inBox(box[0], box[1]) && inBox(box[2], box[3])
+			}
+			return false
+		}, nil
+	case "is":
+		switch arg {
+		case "retweet":
+			return func(s *subject) bool { return s.hasRef("retweeted") }, nil
+		case "reply":
+			return func(s *subject) bool { return s.hasRef("replied_to") }, nil
+		case "quote":
+			return func(s *subject) bool { return s.hasRef("quoted") }, nil
+		case "verified":
+			return func(s *subject) bool { u := s.author(); return u != nil && u.Verified }, nil
+		}
+	case "has":
+		switch arg {
+		case "hashtags":
+			return func(s *subject) bool {
+				return (s.Entities != nil && len(s.Entities.HashTags) != 0) || hasPrefixed(s.words(), "#")
+			}, nil
+		case "cashtags":
+			return func(s *subject) bool {
+				return (s.Entities != nil && len(s.Entities.CashTags) != 0) || hasPrefixed(s.words(), "$")
+			}, nil
+		case "mentions":
+			return func(s *subject) bool {
+				return (s.Entities != nil && len(s.Entities.Mentions) != 0) || hasPrefixed(s.words(), "@")
+			}, nil
+		case "links":
+			return func(s *subject) bool {
+				return (s.Entities != nil && len(s.Entities.URLs) != 0) ||
+					strings.Contains(s.Text, "http://") || strings.Contains(s.Text, "https://")
+			}, nil
+		case "media":
+			return func(s *subject) bool { return len(s.Attachments["media_keys"]) != 0 }, nil
+		case "images":
+			return func(s *subject) bool {
+				return s.hasMedia(func(m *types.Media) bool { return m.Type == "photo" })
+			}, nil
+		case "videos":
+			return func(s *subject) bool {
+				return s.hasMedia(func(m *types.Media) bool { return m.Type == "video" })
+			}, nil
+		case "geo":
+			return func(s *subject) bool { return s.Location != nil }, nil
+		}
+	}
+	return nil, unsupported
+}
+
+// phrase matches tweets whose text contains the tokens of text as a
+// contiguous sequence.
+func phrase(text string) predicate {
+	want := tokens(text)
+	return func(s *subject) bool { return containsSeq(s.words(), want) }
+}
+
+// entityTag matches tweets with the given tag among the entities selected by
+// get. If the tweet has no entities, its text is searched for the tag with
+// the given prefix.
+func entityTag(tag, prefix string, get func(*types.Entities) []*types.Tag) predicate {
+	return func(s *subject) bool {
+		if s.Entities == nil {
+			return containsSeq(s.words(), []string{strings.ToLower(prefix + tag)})
+		}
+		for _, t := range get(s.Entities) {
+			if strings.EqualFold(t.Tag, tag) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// mention matches tweets that mention the given username.
+func mention(name string) predicate {
+	return func(s *subject) bool {
+		if s.Entities == nil {
+			return containsSeq(s.words(), []string{"@" + strings.ToLower(name)})
+		}
+		for _, m := range s.Entities.Mentions {
+			if strings.EqualFold(m.Username, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isUser reports whether the user with the given ID, whose details are in u
+// if known, has the given username or ID.
+func isUser(u *types.User, id, name string) bool {
+	name = strings.TrimPrefix(name, "@")
+	return id == name || (u != nil && strings.EqualFold(u.Username, name))
+}
+
+// tokens splits text into lower-case words. Punctuation separates words,
+// except that the prefixes of hashtags, mentions, and cashtags are kept.
+func tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		switch r {
+		case '#', '@', '$', '_', '\'':
+			return false
+		}
+		return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+}
+
+// containsSeq reports whether want occurs as a contiguous subsequence of ws.
+func containsSeq(ws, want []string) bool {
+	if len(want) == 0 {
+		return false
+	}
+	for i := 0; i+len(want) <= len(ws); i++ {
+		ok := true
+		for j, w := range want {
+			if ws[i+j] != w {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrefixed reports whether any of ws is a tag with the given prefix.
+func hasPrefixed(ws []string, prefix string) bool {
+	for _, w := range ws {
+		if len(w) > len(prefix) && strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/types"
+)
+
+func TestMatch(t *testing.T) {
+	inc := &query.Includes{
+		Users: types.Users{
+			{ID: "1", Username: "alice", Name: "Alice Liddell", Verified: true,
+				Description: "Cat lover, tea drinker.", FuzzyLocation: "Oxford, England",
+				PublicMetrics: types.Metrics{"followers_count": 150, "tweet_count": 2000}},
+			{ID: "2", Username: "bob"},
+		},
+		Tweets: types.Tweets{{ID: "50", Text: "original", AuthorID: "2"}},
+		Media:  types.Medias{{Key: "3_1", Type: "photo"}},
+	}
+	tweets := map[string]*types.Tweet{
+		"plain": {ID: "100", Text: "My cat is sleeping.", AuthorID: "1", Language: "en"},
+		"reply": {
+			ID: "101", Text: "@bob Look at this #CatPic https://t.co/xyz", AuthorID: "1",
+			InReplyTo: "2", ConversationID: "99",
+			Referenced:  []*types.Ref{{Type: "replied_to", ID: "99"}},
+			Attachments: types.Attachments{"media_keys": {"3_1"}},
+			Entities: &types.Entities{
+				HashTags: []*types.Tag{{Tag: "CatPic"}},
+				Mentions: []*types.Mention{{Username: "bob"}},
+				URLs:     []*types.URL{{URL: "https://t.co/xyz", Expanded: "https://example.com/cats"}},
+			},
+		},
+		"retweet": {
+			ID: "102", Text: "RT @bob: original", AuthorID: "1",
+			Referenced: []*types.Ref{{Type: "retweeted", ID: "50"}},
+		},
+	}
+
+	tests := []struct {
+		query string
+		want  []string // names of matching tweets, in order
+	}{
+		{"cat", []string{"plain"}},
+		{"CAT -sleeping", nil},
+		{`"cat is sleeping"`, []string{"plain"}},
+		{`"sleeping cat"`, nil},
+		{"cats", nil},
+		{"from:alice", []string{"plain", "reply", "retweet"}},
+		{"from:1 -is:retweet -is:reply", []string{"plain"}},
+		{"to:bob", []string{"reply"}},
+		{"@bob", []string{"reply", "retweet"}},
+		{"#catpic OR lang:en", []string{"plain", "reply"}},
+		{`url:"example.com/cats"`, []string{"reply"}},
+		{"conversation_id:99", []string{"reply"}},
+		{"retweets_of:bob", []string{"retweet"}},
+		{"from:alice (has:images OR has:links)", []string{"reply"}},
+		{"from:alice has:mentions is:verified", []string{"reply", "retweet"}},
+		{"original -(is:retweet from:alice)", nil},
+		{"retweets_of_tweet_id:50", []string{"retweet"}},
+		{"in_reply_to_tweet_id:99 OR quotes_of_tweet_id:50", []string{"reply"}},
+		{`bio:"cat lover" is:reply`, []string{"reply"}},
+		{"bio_name:liddell OR bio_location:london", []string{"plain", "reply", "retweet"}},
+		{"bio_location:london", nil},
+		{"cat followers_count:100..200 tweets_count:2000", []string{"plain"}},
+		{"cat followers_count:200", nil},
+		{"original following_count:0", nil},
+	}
+	names := []string{"plain", "reply", "retweet"}
+	for _, test := range tests {
+		m, err := query.CompileString(test.query)
+		if err != nil {
+			t.Errorf("CompileString(%q): unexpected error: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, name := range names {
+			if m.Match(tweets[name], inc) {
+				got = append(got, name)
+			}
+		}
+		if !equalStrings(got, test.want) {
+			t.Errorf("Query %q: matched %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	// Queries from the builder can be matched directly.
+	b := query.New()
+	ok, err := query.Match(b.And(b.Hashtag("catpic"), b.Not(b.To("alice"))), tweets["reply"], nil)
+	if err != nil || !ok {
+		t.Errorf("Match: got %v, %v; want true", ok, err)
+	}
+
+	for _, bad := range []string{"", "(cat", "cat OR", "-", `"cat`, "cat is:fluffy", "list:123"} {
+		if m, err := query.CompileString(bad); err == nil {
+			t.Errorf("CompileString(%q): got %+v, want error", bad, m)
+		}
+	}
+}
+
+func TestNewIncludes(t *testing.T) {
+	inc, err := query.NewIncludes(map[string]json.RawMessage{
+		"users":  json.RawMessage(`[{"id":"1","username":"alice"}]`),
+		"polls":  json.RawMessage(`[{"id":"2"}]`),
+		"tweets": nil,
+	})
+	if err != nil {
+		t.Fatalf("NewIncludes: unexpected error: %v", err)
+	}
+	if len(inc.Users) != 1 || inc.Users[0].Username != "alice" || len(inc.Tweets) != 0 {
+		t.Errorf("NewIncludes: got %+v, want one user", inc)
+	}
+
+	// When several kinds are invalid, the error reports the same one each time.
+	for i := 0; i < 10; i++ {
+		inc, err := query.NewIncludes(map[string]json.RawMessage{
+			"users":  json.RawMessage(`{"bogus"`),
+			"media":  json.RawMessage(`{"bogus"`),
+			"places": json.RawMessage(`{"bogus"`),
+		})
+		if err == nil {
+			t.Fatalf("NewIncludes: got %+v, want error", inc)
+		} else if !strings.Contains(err.Error(), "included users") {
+			t.Errorf("NewIncludes: got %v, want an error for users", err)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query
+
+import (
+	"sort"
+	"strings"
+)
+
+// Normalize returns a canonical form of q, so that queries that differ only
+// in the arrangement of their terms render to the same string.
+//
+// Normalization moves negations inward to the terms, flattens nested groups,
+// removes duplicate terms, and sorts the operands of each group in a fixed
+// order: terms before negated terms before subgroups, each in lexical order.
+// Terms that are not sensitive to case, such as keywords, phrases, hashtags,
+// mentions, and user names, are converted to lower case. It also simplifies
+// groups using the rules
+//
+//	a (a OR b)  ⇒  a              a OR (a b)  ⇒  a
+//	a (b OR -b) ⇒  a              a OR (b -b) ⇒  a
+//
+// Tautologies and contradictions are simplified only as operands of a group.
+// A query that is itself always true or always false, such as "dog OR -dog"
+// or "dog -dog", has no simpler form that the search syntax can express, so it
+// is not simplified, and does not compare equal to other such queries.
+//
+// A query that cannot be normalized, such as one containing a term from the
+// Builder with invalid arguments, is returned unchanged.
+func Normalize(q Query) Query {
+	if hasInvalid(q) {
+		return q
+	} else if !isNative(q) {
+		pq, err := Parse(q.String())
+		if err != nil {
+			return q
+		}
+		q = pq
+	}
+	return normalize(q, false)
+}
+
+// isNative reports whether q and all its subqueries are implemented by this
+// package.
+func isNative(q Query) bool {
+	switch t := q.(type) {
+	case andQuery:
+		return allNative(t)
+	case orQuery:
+		return allNative(t)
+	case notQuery:
+		return isNative(t.sub)
+	case solo, nsolo, quoted:
+		return true
+	}
+	return false
+}
+
+func allNative(qs []Query) bool {
+	for _, q := range qs {
+		if !isNative(q) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasInvalid reports whether q contains an invalid term from the Builder.
+func hasInvalid(q Query) bool {
+	switch t := q.(type) {
+	case andQuery:
+		return anyInvalid(t)
+	case orQuery:
+		return anyInvalid(t)
+	case notQuery:
+		return hasInvalid(t.sub)
+	case invalid:
+		return true
+	}
+	return false
+}
+
+func anyInvalid(qs []Query) bool {
+	for _, q := range qs {
+		if hasInvalid(q) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize returns the normal form of q, negated if neg is true.
+func normalize(q Query, neg bool) Query {
+	switch t := q.(type) {
+	case andQuery:
+		if neg {
+			return normalizeGroup(t, true, false) // -(a b) ⇒ -a OR -b
+		}
+		return normalizeGroup(t, false, true)
+	case orQuery:
+		if neg {
+			return normalizeGroup(t, true, true) // -(a OR b) ⇒ -a -b
+		}
+		return normalizeGroup(t, false, false)
+	case notQuery:
+		return normalize(t.sub, !neg)
+	case solo:
+		q = solo(normalTerm(string(t)))
+	case nsolo:
+		q = nsolo(normalTerm(string(t)))
+	case quoted:
+		if t.tag == "" {
+			t.arg = strings.ToLower(t.arg)
+		}
+		q = t
+	}
+	if neg {
+		return notQuery{q}
+	}
+	return q
+}
+
+// normalizeGroup normalizes the operands of a group, negated if neg is true,
+// and combines them as a conjunction if and is true, or a disjunction.
+func normalizeGroup(qs []Query, neg, and bool) Query {
+	var args []Query
+	seen := make(map[string]bool)
+	add := func(q Query) {
+		if key := q.String(); !seen[key] {
+			seen[key] = true
+			args = append(args, q)
+		}
+	}
+	for _, q := range qs {
+		nq := normalize(q, neg)
+		if sub, ok := groupArgs(nq, and); ok {
+			for _, elt := range sub {
+				add(elt)
+			}
+		} else {
+			add(nq)
+		}
+	}
+
+	// Remove operands that are subsumed by another (absorption), or that are
+	// always true in a conjunction or always false in a disjunction.
+	var keep []Query
+	for _, q := range args {
+		sub, ok := groupArgs(q, !and)
+		if ok && (hasAny(sub, seen) || isComplementary(sub)) {
+			continue
+		}
+		keep = append(keep, q)
+	}
+	if len(keep) == 0 {
+		keep = args
+	}
+
+	sort.SliceStable(keep, func(i, j int) bool {
+		ri, rj := sortRank(keep[i]), sortRank(keep[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keep[i].String() < keep[j].String()
+	})
+	if len(keep) == 1 {
+		return keep[0]
+	} else if and {
+		return andQuery(keep)
+	}
+	return orQuery(keep)
+}
+
+// groupArgs returns the operands of q if it is a conjunction (and == true) or
+// a disjunction (and == false).
+func groupArgs(q Query, and bool) ([]Query, bool) {
+	if and {
+		t, ok := q.(andQuery)
+		return t, ok
+	}
+	t, ok := q.(orQuery)
+	return t, ok
+}
+
+// hasAny reports whether any of qs is in the set of keys.
+func hasAny(qs []Query, keys map[string]bool) bool {
+	for _, q := range qs {
+		if keys[q.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// isComplementary reports whether qs contains both a query and its negation.
+func isComplementary(qs []Query) bool {
+	pos := make(map[string]bool)
+	for _, q := range qs {
+		if _, ok := q.(notQuery); !ok {
+			pos[q.String()] = true
+		}
+	}
+	for _, q := range qs {
+		if t, ok := q.(notQuery); ok && pos[t.sub.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+func sortRank(q Query) int {
+	switch q.(type) {
+	case andQuery, orQuery:
+		return 2
+	case notQuery:
+		return 1
+	}
+	return 0
+}
+
+// normalTerm returns the normal form of an unquoted term.
+func normalTerm(term string) string {
+	op, arg := splitTerm(term)
+	switch op {
+	case "":
+		if !strings.Contains(term, "://") {
+			return strings.ToLower(term)
+		}
+	case "from", "to", "retweets_of":
+		if !strings.HasPrefix(arg, `"`) {
+			return op + ":" + strings.ToLower(strings.TrimPrefix(arg, "@"))
+		}
+	}
+	return term
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query_test
+
+import (
+	"testing"
+
+	"github.com/nankys/twitter/query"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"cat", "cat"},
+		{"Cat DOG", "cat dog"},
+		{"dog cat", "cat dog"},
+		{"dog OR cat OR dog", "cat OR dog"},
+		{"cat cat dog", "cat dog"},
+		{`"The Cat" #CatPic @Bob`, `"the cat" #catpic @bob`},
+		{"from:@Alice to:BOB lang:zh-TW", "from:alice lang:zh-TW to:bob"},
+		{"https://Example.com/A", "https://Example.com/A"},
+
+		// Grouping and flattening.
+		{"(cat dog) (bird fish)", "bird cat dog fish"},
+		{"cat OR (dog OR bird)", "bird OR cat OR dog"},
+		{"(dog OR cat) bird", "bird (cat OR dog)"},
+		{"(b a) OR (a b)", "a b"},
+		{"(b OR a) (a OR b)", "a OR b"},
+
+		// Negation.
+		{"-is:retweet cat", "cat -is:retweet"},
+		{"-(cat dog) bird", "bird (-cat OR -dog)"},
+		{"-(cat OR dog) bird", "bird -cat -dog"},
+		{"-(-cat OR dog) bird", "bird cat -dog"},
+
+		// Simplification.
+		{"cat (cat OR dog)", "cat"},
+		{"cat OR (cat dog)", "cat"},
+		{"cat (dog OR -dog)", "cat"},
+		{"cat OR (dog -dog)", "cat"},
+	}
+	for _, test := range tests {
+		q, err := query.Parse(test.input)
+		if err != nil {
+			t.Fatalf("Parse(%q): unexpected error: %v", test.input, err)
+		}
+		got := query.Normalize(q).String()
+		if got != test.want {
+			t.Errorf("Normalize(%q): got %q, want %q", test.input, got, test.want)
+		}
+
+		// Normalization is idempotent, including through a round trip.
+		if again := query.Normalize(query.Normalize(q)).String(); again != got {
+			t.Errorf("Normalize(Normalize(%q)): got %q, want %q", test.input, again, got)
+		}
+		p, err := query.Parse(got)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", got, err)
+		} else if again := query.Normalize(p).String(); again != got {
+			t.Errorf("Normalize(Parse(%q)): got %q", got, again)
+		}
+	}
+
+	// Equivalent rules written differently normalize to the same string.
+	b := query.New()
+	x := b.And(b.Or(b.Word("dog"), b.Word("cat")), b.Not(b.IsRetweet()), b.From("@Alice"))
+	y, err := query.Parse("-is:retweet (cat OR dog) from:alice")
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if nx, ny := query.Normalize(x).String(), query.Normalize(y).String(); nx != ny {
+		t.Errorf("Normalize: got %q and %q, want equal", nx, ny)
+	}
+
+	// Invalid terms are preserved.
+	bad := b.And(b.Word("cat"), b.Sample(0))
+	if got := query.Normalize(bad); got.String() != bad.String() || query.Validate(got, query.Elevated) == nil {
+		t.Errorf("Normalize(%s): got %s, want unchanged", bad, got)
+	}
+}
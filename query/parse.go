@@ -0,0 +1,303 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An operator describes a query operator of the form name:value.
+type operator struct {
+	standalone bool // whether the operator may be used on its own
+	tier       Tier // the lowest access tier at which the operator is available
+
+	// If non-nil, the values permitted for the operator, and the lowest tier
+	// at which each is available. This overrides tier.
+	values map[string]Tier
+}
+
+// operators lists the operators recognized by the parser, by name.
+var operators = map[string]operator{
+	// Standalone operators.
+	"from":                 {standalone: true},
+	"to":                   {standalone: true},
+	"url":                  {standalone: true},
+	"retweets_of":          {standalone: true},
+	"context":              {standalone: true},
+	"entity":               {standalone: true},
+	"conversation_id":      {standalone: true},
+	"list":                 {standalone: true},
+	"in_reply_to_tweet_id": {standalone: true},
+	"retweets_of_tweet_id": {standalone: true},
+	"quotes_of_tweet_id":   {standalone: true},
+	"bio":                  {standalone: true, tier: Elevated},
+	"bio_name":             {standalone: true, tier: Elevated},
+	"bio_location":         {standalone: true, tier: Elevated},
+	"place":                {standalone: true, tier: Elevated},
+	"place_country":        {standalone: true, tier: Elevated},
+	"point_radius":         {standalone: true, tier: Elevated},
+	"bounding_box":         {standalone: true, tier: Elevated},
+
+	// Operators that must be combined with a standalone operator.
+	"is": {values: map[string]Tier{
+		"retweet":  Essential,
+		"reply":    Essential,
+		"quote":    Essential,
+		"verified": Essential,
+		"nullcast": Elevated,
+	}},
+	"has": {values: map[string]Tier{
+		"hashtags": Essential,
+		"links":    Essential,
+		"mentions": Essential,
+		"media":    Essential,
+		"images":   Essential,
+		"videos":   Essential,
+		"cashtags": Elevated,
+		"geo":      Elevated,
+	}},
+	"lang":            {},
+	"sample":          {tier: Elevated},
+	"followers_count": {tier: Academic},
+	"following_count": {tier: Academic},
+	"tweets_count":    {tier: Academic},
+	"listed_count":    {tier: Academic},
+}
+
+// A SyntaxError reports a syntax error in a query string.
+type SyntaxError struct {
+	Offset  int    // the byte offset in the input where the error occurred
+	Message string // a description of the error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Message)
+}
+
+func syntaxErrorf(offset int, msg string, args ...interface{}) error {
+	return &SyntaxError{Offset: offset, Message: fmt.Sprintf(msg, args...)}
+}
+
+// Parse parses a search query or rule string into a Query. If s is not a
+// syntactically valid query, Parse reports an error of concrete type
+// *SyntaxError.
+//
+// The query is a sequence of terms, all of which must match. Terms separated
+// by OR must match at least one; conjunction binds more tightly than OR, and
+// parentheses group terms. A term with a leading "-" is negated. A term is a
+// keyword, a quoted phrase, a #hashtag, @mention, or $cashtag, or an
+// operator:value pair. The value of an operator may be quoted, and may be a
+// bracketed list as for point_radius:[lon lat radius].
+//
+// Parsing the String of a Query gives back an equivalent Query, whose own
+// String is the same. Operator names are checked, but their values are not.
+func Parse(s string) (Query, error) {
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	} else if len(toks) == 0 {
+		return nil, syntaxErrorf(0, "empty query")
+	}
+	p := &parser{toks: toks, end: len(s)}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	} else if tok := p.peek(); tok.text != "" {
+		return nil, syntaxErrorf(tok.pos, "unexpected %q", tok.text)
+	}
+	return q, nil
+}
+
+// A token is a lexical element of a query, with its byte offset.
+type token struct {
+	text string
+	pos  int
+}
+
+// tokenize splits a query into tokens. Parentheses, negations, and the OR
+// operator are separate tokens; a quoted phrase or a bracketed value is part
+// of a single token including its delimiters.
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += n
+		case r == '(' || r == ')':
+			toks = append(toks, token{text: string(r), pos: i})
+			i++
+		case r == '-':
+			if next, _ := utf8.DecodeRuneInString(s[i+1:]); i+1 == len(s) || unicode.IsSpace(next) {
+				return nil, syntaxErrorf(i, "negation without a term")
+			}
+			toks = append(toks, token{text: "-", pos: i})
+			i++
+		default:
+			j, err := scanTerm(s, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{text: s[i:j], pos: i})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+// scanTerm returns the offset of the end of the term beginning at offset i of
+// s. A term ends at a space or parenthesis outside quotation marks or
+// brackets.
+func scanTerm(s string, i int) (int, error) {
+	var close byte // the closing delimiter we are looking for, or 0
+	var open int   // the offset of the opening delimiter
+	j := i
+	for j < len(s) {
+		r, n := utf8.DecodeRuneInString(s[j:])
+		if close != 0 {
+			if byte(r) == close {
+				close = 0
+			}
+		} else if r == '"' {
+			close, open = '"', j
+		} else if r == '[' && j > i && s[j-1] == ':' {
+			close, open = ']', j
+		} else if unicode.IsSpace(r) || r == '(' || r == ')' {
+			break
+		}
+		j += n
+	}
+	if close == '"' {
+		return 0, syntaxErrorf(open, "unterminated quotation")
+	} else if close == ']' {
+		return 0, syntaxErrorf(open, "unterminated bracket")
+	}
+	return j, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	end  int // the length of the input, for errors at the end
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return token{pos: p.end}
+}
+
+func (p *parser) parseOr() (Query, error) {
+	var alts []Query
+	for {
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, q)
+		if p.peek().text != "OR" {
+			return newOrQuery(alts), nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseAnd() (Query, error) {
+	var all []Query
+	for {
+		switch tok := p.peek(); tok.text {
+		case "", ")", "OR":
+			if len(all) != 0 {
+				return newAndQuery(all), nil
+			} else if tok.text == "" {
+				return nil, syntaxErrorf(tok.pos, "missing term at end of query")
+			} else if tok.text == ")" && p.pos > 0 && p.toks[p.pos-1].text == "(" {
+				return nil, syntaxErrorf(p.toks[p.pos-1].pos, "empty group")
+			}
+			return nil, syntaxErrorf(tok.pos, "missing term before %q", tok.text)
+		}
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, q)
+	}
+}
+
+func (p *parser) parseUnary() (Query, error) {
+	tok := p.peek()
+	p.pos++
+	switch tok.text {
+	case "-":
+		switch next := p.peek(); next.text {
+		case "", ")", "OR", "-":
+			return nil, syntaxErrorf(tok.pos, "negation without a term")
+		}
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return newNotQuery(q), nil
+	case "(":
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		} else if p.peek().text != ")" {
+			return nil, syntaxErrorf(tok.pos, "unbalanced parenthesis")
+		}
+		p.pos++
+		return q, nil
+	default:
+		return parseTerm(tok)
+	}
+}
+
+// parseTerm converts a single term into a Query.
+func parseTerm(tok token) (Query, error) {
+	text := tok.text
+	if strings.HasPrefix(text, `"`) {
+		if !strings.HasSuffix(text, `"`) || len(text) < 2 {
+			return nil, syntaxErrorf(tok.pos, "invalid quoted phrase %s", text)
+		}
+		return quoted{arg: text[1 : len(text)-1]}, nil
+	}
+	op, arg := splitTerm(text)
+	if op == "" {
+		return solo(text), nil
+	}
+	info, ok := operators[op]
+	if !ok {
+		return nil, syntaxErrorf(tok.pos, "unknown operator %q", op+":")
+	} else if arg == "" {
+		return nil, syntaxErrorf(tok.pos+len(op)+1, "missing value for operator %q", op+":")
+	}
+	if strings.HasPrefix(arg, `"`) {
+		if !strings.HasSuffix(arg, `"`) || len(arg) < 2 {
+			return nil, syntaxErrorf(tok.pos+len(op)+1, "invalid quoted value %s", arg)
+		}
+		return quoted{tag: op + ":", arg: arg[1 : len(arg)-1], conj: !info.standalone}, nil
+	} else if !info.standalone {
+		return nsolo(text), nil
+	}
+	return solo(text), nil
+}
+
+// splitTerm splits a term into an operator and its argument. For a term that
+// is not an operator:value pair, op == "" and arg == term. An operator name
+// consists of lower-case letters and underscores.
+func splitTerm(term string) (op, arg string) {
+	i := strings.Index(term, ":")
+	if i <= 0 || strings.HasPrefix(term[i:], "://") {
+		return "", term // not an operator, or a URL
+	}
+	for _, r := range term[:i] {
+		if r != '_' && (r < 'a' || r > 'z') {
+			return "", term
+		}
+	}
+	return term[:i], term[i+1:]
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nankys/twitter/query"
+)
+
+// parseTests are query strings, their renderings after parsing, and whether
+// the parsed queries are valid.
+var parseTests = []struct {
+	input, want string
+	valid       bool
+}{
+	{"cat", "cat", true},
+	{"  cat   dog ", "cat dog", true},
+	{`"you are here"`, `"you are here"`, true},
+	{"cat OR dog", "cat OR dog", true},
+	{"cat dog OR sheep goat", "(cat dog) OR (sheep goat)", true},
+	{"cat (dog OR sheep)", "cat (dog OR sheep)", true},
+	{"((a b) c)", "a b c", true},
+	{"a OR (b OR c)", "a OR b OR c", true},
+	{"cat or dog", "cat or dog", true},
+	{"-cat dog", "-cat dog", true},
+	{"-(cat dog) bird", "(-cat OR -dog) bird", true},
+	{`-"not this"`, `-"not this"`, true},
+	{"#golang @alice $TWTR", "#golang @alice $TWTR", true},
+	{"from:alice -is:retweet", "from:alice -is:retweet", true},
+	{`url:"https://example.com/a b"`, `url:"https://example.com/a b"`, true},
+	{`place:"new york city"`, `place:"new york city"`, true},
+	{"point_radius:[2.355128 48.861118 16km] has:geo", "point_radius:[2.355128 48.861118 16km] has:geo", true},
+	{"https://example.com", "https://example.com", true},
+	{"12:30 lunch", "12:30 lunch", true},
+	{"has:images lang:en", "has:images lang:en", false},
+	{"has:images OR lang:en", "has:images OR lang:en", false},
+	{"cat has:images", "cat has:images", true},
+	{`is:"retweet"`, `is:"retweet"`, false},
+	{`lang:"en" cat`, `lang:"en" cat`, true},
+	{`from:"alice"`, `from:"alice"`, true},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		q, err := query.Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", test.input, err)
+			continue
+		}
+		if got := q.String(); got != test.want {
+			t.Errorf("Parse(%q): got %q, want %q", test.input, got, test.want)
+		}
+		if got := q.Valid(); got != test.valid {
+			t.Errorf("Parse(%q).Valid(): got %v, want %v", test.input, got, test.valid)
+		}
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	b := query.New()
+	for _, q := range []query.Query{
+		b.And(
+			b.Or(b.All("red", "green", "blue"), b.Some("black", "white")),
+			b.HasImages(),
+			b.Not(b.IsRetweet()),
+			b.IsReply(),
+		),
+		b.Not(b.And(b.Word("you are gone"), b.From("@bob"))),
+		b.Or(b.URL("https://example.com"), b.Hashtag("x"), b.Not(b.Some("a", "b"))),
+		b.And(b.Entity("Michael Jordan"), b.Lang("en"), b.InThread("12345")),
+		b.And(b.Not(b.Some("a", "b")), b.Word("c")),
+		b.Or(b.Not(b.All("a", "b")), b.Word("c")),
+	} {
+		checkRoundTrip(t, q)
+	}
+
+	// Parsing the rendering of any query in the test fixtures gives back a
+	// query with the same rendering.
+	for _, test := range validQueries() {
+		checkRoundTrip(t, test.input)
+	}
+	for _, test := range parseTests {
+		q, err := query.Parse(test.input)
+		if err != nil {
+			t.Fatalf("Parse(%q): unexpected error: %v", test.input, err)
+		}
+		checkRoundTrip(t, q)
+	}
+}
+
+func checkRoundTrip(t *testing.T, q query.Query) {
+	t.Helper()
+	s := q.String()
+	p, err := query.Parse(s)
+	if err != nil {
+		t.Errorf("Parse(%q): unexpected error: %v", s, err)
+		return
+	}
+	if got := p.String(); got != s {
+		t.Errorf("Parse(%q).String(): got %q", s, got)
+	}
+	if p.Valid() != q.Valid() {
+		t.Errorf("Parse(%q).Valid(): got %v, want %v", s, p.Valid(), q.Valid())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{"(cat dog", 0},
+		{"cat (dog OR", 11},
+		{"cat OR", 6},
+		{"OR cat", 0},
+		{"cat )", 4},
+		{"cat ()", 4},
+		{"cat -", 4},
+		{"cat - dog", 4},
+		{`cat "dog`, 4},
+		{"bounding_box:[1 2 3", 13},
+		{"bogus:value", 0},
+		{"cat from:", 9},
+		{`url:"abc"def`, 4},
+		{"--cat", 0},
+	}
+	for _, test := range tests {
+		q, err := query.Parse(test.input)
+		var serr *query.SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("Parse(%q): got %v, %v; want syntax error", test.input, q, err)
+		} else if serr.Offset != test.offset {
+			t.Errorf("Parse(%q): error at offset %d, want %d (%v)", test.input, serr.Offset, test.offset, err)
+		}
+	}
+}
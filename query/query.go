@@ -1,9 +1,59 @@
 // Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
 
 // Package query defines a structured builder for search query strings.
+//
+// # Parsing
+//
+// Parse converts a query or rule string, such as one returned by rules.Get,
+// back into a Query that can be inspected, rewritten, or matched:
+//
+//	q, err := query.Parse(`(cat OR dog) has:images -is:retweet`)
+//
+// Syntax errors are reported as *SyntaxError values, giving the offset of the
+// problem in the input.
+//
+// # Validation
+//
+// The Valid method of a Query checks only that it contains a standalone term.
+// Validate and ValidateString check a query more thoroughly against the rules
+// of an access tier, and report every problem found:
+//
+//	if err := query.ValidateString(rule, query.Elevated); err != nil {
+//	   log.Printf("Invalid rule: %v", err)
+//	}
+//
+// # Normalization
+//
+// Normalize rewrites a query into a canonical form, so that equivalent rules
+// written in different ways, such as "(dog OR cat) -is:retweet" and
+// "-is:retweet (cat OR dog)", render to the same string:
+//
+//	if query.Normalize(q1).String() == query.Normalize(q2).String() {
+//	   log.Print("Duplicate rule")
+//	}
+//
+// # Matching
+//
+// A Matcher evaluates a query against tweets locally, without consulting the
+// API. This is useful to re-filter stored tweets, to check rules before they
+// are deployed, or to route tweets from a stream:
+//
+//	m, err := query.CompileString(`cat has:images -is:retweet`)
+//	...
+//	inc, err := query.NewIncludes(rsp.Includes)
+//	...
+//	for _, t := range rsp.Tweets {
+//	   if m.Match(t, inc) {
+//	      handle(t)
+//	   }
+//	}
 package query
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // A Query represents a query structure that can be rendered into a query
 // string and checked for validity.
@@ -67,15 +117,54 @@ func (Builder) Entity(s string) Query { return solo("entity:" + s) }
 // InThread matches tweets with the specified conversation ID.
 func (Builder) InThread(s string) Query { return solo("conversation_id:" + s) }
 
+// RetweetOfTweet matches retweets of the tweet with the specified ID.
+func (Builder) RetweetOfTweet(id string) Query { return solo("retweets_of_tweet_id:" + id) }
+
+// QuoteOfTweet matches quote tweets of the tweet with the specified ID.
+func (Builder) QuoteOfTweet(id string) Query { return solo("quotes_of_tweet_id:" + id) }
+
+// ReplyToTweet matches replies to the tweet with the specified ID.
+func (Builder) ReplyToTweet(id string) Query { return solo("in_reply_to_tweet_id:" + id) }
+
+// Cashtag matches tweets that contain the specified cashtag, such as "$TWTR".
+// This operator requires Elevated access.
+func (Builder) Cashtag(s string) Query { return solo("$" + untag("$", s)) }
+
+// List matches tweets from members of the list with the specified ID.
+func (Builder) List(id string) Query { return solo("list:" + id) }
+
+// Bio matches tweets from users whose profile description contains the
+// specified keyword or phrase. This operator requires Elevated access.
+func (Builder) Bio(s string) Query { return newTagged("bio:", s) }
+
+// BioName matches tweets from users whose profile name contains the specified
+// keyword. This operator requires Elevated access.
+func (Builder) BioName(s string) Query { return newTagged("bio_name:", s) }
+
+// BioLocation matches tweets from users whose profile location contains the
+// specified keyword or phrase. This operator requires Elevated access.
+func (Builder) BioLocation(s string) Query { return newTagged("bio_location:", s) }
+
 // IsReply matches only tweets that are replies (without specifying to whom).
 func (Builder) IsReply() Query { return nsolo("is:reply") }
 
 // IsRetweet matches "natural" retweets (not quoted).
 func (Builder) IsRetweet() Query { return nsolo("is:retweet") }
 
+// IsQuote matches quote tweets.
+func (Builder) IsQuote() Query { return nsolo("is:quote") }
+
 // IsVerified matches tweets whose authors are verified.
 func (Builder) IsVerified() Query { return nsolo("is:verified") }
 
+// IsNullcast matches tweets created for promotion only. It is usually negated.
+// This operator requires Elevated access.
+func (Builder) IsNullcast() Query { return nsolo("is:nullcast") }
+
+// HasCashtags matches tweets that contain at least one cashtag.
+// This operator requires Elevated access.
+func (Builder) HasCashtags() Query { return nsolo("has:cashtags") }
+
 // HasHashtags matches tweets that contain at least one hashtag.
 func (Builder) HasHashtags() Query { return nsolo("has:hashtags") }
 
@@ -99,6 +188,37 @@ func (Builder) HasVideos() Query { return nsolo("has:videos") }
 // have at most one language tag assigned.
 func (Builder) Lang(s string) Query { return nsolo("lang:" + s) }
 
+// Sample matches a random sample of the given percentage, from 1 to 100, of
+// the tweets that match the rest of the query. This operator requires Elevated
+// access.
+func (Builder) Sample(percent int) Query {
+	term := "sample:" + strconv.Itoa(percent)
+	if percent < 1 || percent > 100 {
+		return invalid{term: term, err: fmt.Errorf("sample percentage %d out of range [1, 100]", percent)}
+	}
+	return nsolo(term)
+}
+
+// FollowersCount matches tweets whose authors have between lo and hi
+// followers, inclusive. If hi == 0, there is no upper bound.
+// This operator requires Academic access.
+func (Builder) FollowersCount(lo, hi int) Query { return newCount("followers_count:", lo, hi) }
+
+// FollowingCount matches tweets whose authors follow between lo and hi
+// users, inclusive. If hi == 0, there is no upper bound.
+// This operator requires Academic access.
+func (Builder) FollowingCount(lo, hi int) Query { return newCount("following_count:", lo, hi) }
+
+// TweetsCount matches tweets whose authors have posted between lo and hi
+// tweets, inclusive. If hi == 0, there is no upper bound.
+// This operator requires Academic access.
+func (Builder) TweetsCount(lo, hi int) Query { return newCount("tweets_count:", lo, hi) }
+
+// ListedCount matches tweets whose authors have been listed between lo and hi
+// times, inclusive. If hi == 0, there is no upper bound.
+// This operator requires Academic access.
+func (Builder) ListedCount(lo, hi int) Query { return newCount("listed_count:", lo, hi) }
+
 type solo string
 
 func (s solo) String() string { return string(s) }
@@ -106,10 +226,11 @@ func (solo) Valid() bool      { return true }
 
 type quoted struct {
 	tag, arg string
+	conj     bool // the operator is conjunction-only
 }
 
 func (s quoted) String() string { return s.tag + `"` + s.arg + `"` }
-func (quoted) Valid() bool      { return true }
+func (s quoted) Valid() bool    { return !s.conj }
 
 type nsolo string
 
@@ -118,12 +239,12 @@ func (nsolo) Valid() bool      { return false }
 
 type orQuery []Query
 
-func (q orQuery) String() string { return strings.Join(compile(q), " OR ") }
+func (q orQuery) String() string { return strings.Join(compile(q, groupOr), " OR ") }
 func (q orQuery) Valid() bool    { return len(q) != 0 && isStandalone(q) }
 
 type andQuery []Query
 
-func (q andQuery) String() string { return strings.Join(compile(q), " ") }
+func (q andQuery) String() string { return strings.Join(compile(q, groupAnd), " ") }
 func (q andQuery) Valid() bool    { return len(q) != 0 && isStandalone(q) }
 
 type notQuery struct{ sub Query }
@@ -149,11 +270,15 @@ func negateAll(qs []Query) []Query {
 	return neg
 }
 
-func compile(qs []Query) []string {
+// compile renders the operands of a group of the given kind. An operand that
+// renders as a group of a different kind is parenthesized. An operand that
+// renders as a group of the same kind is not, since the parser would merge
+// it into the enclosing group, and the rendering would not be stable.
+func compile(qs []Query, kind int) []string {
 	var args []string
 	for _, elt := range qs {
 		s := elt.String()
-		if isCompound(elt) {
+		if k := groupKind(elt); k != groupNone && k != kind {
 			args = append(args, "("+s+")")
 		} else {
 			args = append(args, s)
@@ -171,17 +296,34 @@ func isStandalone(qs []Query) bool {
 	return false
 }
 
-func isCompound(q Query) bool {
+// Kinds of group, as rendered.
+const (
+	groupNone = iota
+	groupAnd
+	groupOr
+)
+
+// groupKind reports the kind of group that q renders as. A negated group
+// renders as a group of the opposite kind.
+func groupKind(q Query) int {
 	switch t := q.(type) {
 	case andQuery:
-		return len(t) > 1
+		if len(t) > 1 {
+			return groupAnd
+		}
 	case orQuery:
-		return len(t) > 1
+		if len(t) > 1 {
+			return groupOr
+		}
 	case notQuery:
-		return isCompound(t.sub)
-	default:
-		return false
+		switch groupKind(t.sub) {
+		case groupAnd:
+			return groupOr
+		case groupOr:
+			return groupAnd
+		}
 	}
+	return groupNone
 }
 
 func untag(tag, s string) string { return strings.TrimPrefix(s, tag) }
@@ -194,6 +336,48 @@ func newWord(s string) Query {
 	return solo(trim)
 }
 
+func newTagged(tag, s string) Query {
+	trim := strings.TrimSpace(s)
+	if strings.ContainsAny(trim, " \t") {
+		return quoted{tag: tag, arg: trim}
+	}
+	return solo(tag + trim)
+}
+
+func newCount(tag string, lo, hi int) Query {
+	term := tag + strconv.Itoa(lo)
+	if hi != 0 {
+		term += ".." + strconv.Itoa(hi)
+	}
+	if _, _, err := parseCount(strings.TrimPrefix(term, tag)); err != nil {
+		return invalid{term: term, err: err}
+	}
+	return nsolo(term)
+}
+
+// parseCount parses the value of a count operator, either "n" or "lo..hi".
+// For "n", hi == -1.
+func parseCount(arg string) (lo, hi int, err error) {
+	los, his := arg, ""
+	if i := strings.Index(arg, ".."); i >= 0 {
+		los, his = arg[:i], arg[i+2:]
+	}
+	lo, err = strconv.Atoi(los)
+	if err != nil || lo < 0 {
+		return 0, 0, fmt.Errorf("invalid count %q", los)
+	}
+	if his == "" && los == arg {
+		return lo, -1, nil
+	}
+	hi, err = strconv.Atoi(his)
+	if err != nil || hi < 0 {
+		return 0, 0, fmt.Errorf("invalid count %q", his)
+	} else if hi < lo {
+		return 0, 0, fmt.Errorf("count range %d..%d is empty", lo, hi)
+	}
+	return lo, hi, nil
+}
+
 func words(ss []string) []Query {
 	q := make([]Query, len(ss))
 	for i, s := range ss {
@@ -27,13 +27,17 @@ func Example() {
 	// Query: ((red green blue) OR black OR white) has:images -is:retweet is:reply
 }
 
-func TestValidQueries(t *testing.T) {
+// A builderTest is a query constructed with a Builder, and its rendering.
+type builderTest struct {
+	input query.Query
+	want  string
+}
+
+// validQueries returns valid queries constructed with a Builder.
+func validQueries() []builderTest {
 	var b query.Builder
 
-	tests := []struct {
-		input query.Query
-		want  string
-	}{
+	return []builderTest{
 		{b.Word("cat"), "cat"},
 		{b.Word("you are here"), `"you are here"`},
 		{b.Not(b.Word("you are gone")), `-"you are gone"`},
@@ -99,8 +103,35 @@ func TestValidQueries(t *testing.T) {
 			b.Not(b.And(b.HasLinks(), b.InThread("122"))),
 		)),
 			`(-six OR -"strapping stars") has:links conversation_id:122`},
+
+		// Standalone operators.
+		{b.Cashtag("$TWTR"), "$TWTR"},
+		{b.List("1234"), "list:1234"},
+		{b.Bio("cat lover"), `bio:"cat lover"`},
+		{b.BioName("Alice"), "bio_name:Alice"},
+		{b.BioLocation(" new york "), `bio_location:"new york"`},
+		{b.RetweetOfTweet("20"), "retweets_of_tweet_id:20"},
+		{b.QuoteOfTweet("21"), "quotes_of_tweet_id:21"},
+		{b.ReplyToTweet("22"), "in_reply_to_tweet_id:22"},
+
+		{b.And(
+			b.Word("cat"),
+			b.IsQuote(),
+			b.Not(b.IsNullcast()),
+			b.HasCashtags(),
+			b.Sample(10),
+			b.FollowersCount(500, 0),
+			b.FollowingCount(0, 100),
+			b.TweetsCount(1000, 10000),
+			b.ListedCount(5, 5),
+		),
+			"cat is:quote -is:nullcast has:cashtags sample:10 followers_count:500 " +
+				"following_count:0..100 tweets_count:1000..10000 listed_count:5..5"},
 	}
-	for _, test := range tests {
+}
+
+func TestValidQueries(t *testing.T) {
+	for _, test := range validQueries() {
 		if !test.input.Valid() {
 			t.Errorf("Query: %+v is invalid", test.input)
 		}
@@ -127,6 +158,22 @@ func TestInvalidQueries(t *testing.T) {
 			b.Not(b.HasVideos()),
 		)),
 		b.Not(b.IsReply()),
+		b.And(
+			b.IsQuote(),
+			b.IsNullcast(),
+			b.HasCashtags(),
+			b.Sample(50),
+			b.FollowersCount(10, 0),
+			b.FollowingCount(10, 0),
+			b.TweetsCount(10, 0),
+			b.ListedCount(10, 0),
+		),
+
+		// Out-of-range values are never valid.
+		b.Sample(0),
+		b.Sample(101),
+		b.FollowersCount(-1, 0),
+		b.FollowersCount(10, 5),
 		b.And(), // empty
 		b.Or(),  // empty
 	}
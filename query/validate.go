@@ -0,0 +1,264 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Tier identifies an API access level, which determines the maximum length
+// of a query and the operators it may use.
+type Tier int
+
+// Access tiers, in increasing order of capability.
+const (
+	Essential Tier = iota
+	Elevated
+	Academic
+)
+
+var tierNames = [...]string{"Essential", "Elevated", "Academic"}
+
+func (t Tier) String() string {
+	if t >= 0 && int(t) < len(tierNames) {
+		return tierNames[t]
+	}
+	return fmt.Sprintf("Tier(%d)", int(t))
+}
+
+// MaxLength returns the maximum length of a query, in characters, at tier t.
+func (t Tier) MaxLength() int {
+	switch {
+	case t >= Academic:
+		return 4096
+	case t == Elevated:
+		return 1024
+	}
+	return 512
+}
+
+// A Problem describes a single problem with a query.
+type Problem struct {
+	Term    string // the term or group with the problem, or "" for the whole query
+	Message string // a description of the problem
+}
+
+func (p *Problem) Error() string {
+	if p.Term == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", p.Term, p.Message)
+}
+
+// Problems is a collection of problems with a query. It implements the error
+// interface.
+type Problems []*Problem
+
+func (ps Problems) Error() string {
+	msgs := make([]string, len(ps))
+	for i, p := range ps {
+		msgs[i] = p.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks q for problems that would cause the service to reject it at
+// the given access tier. If any are found, Validate returns all of them as a
+// Problems value; otherwise it returns nil.
+//
+// The checks include the length of the query, operators not available at the
+// tier, conjunction-only operators without a standalone operator, groups that
+// contain only negated terms, empty groups, unknown operator values,
+// unsupported language codes, invalid geo coordinates and distances, and
+// invalid sample percentages and count ranges.
+//
+// Validate is deliberately stricter than the Valid method of a Query. Valid
+// reports whether a query contains any standalone term, but the service also
+// requires each alternative of a disjunction to stand on its own, since it
+// would otherwise match on a conjunction-only operator alone. For example,
+// "cat OR has:images" is Valid, but Validate reports a problem with has:images.
+func Validate(q Query, tier Tier) error {
+	return validate(q, q.String(), tier)
+}
+
+// ValidateString parses s and checks it as Validate does, for use with rule
+// strings and search queries. If s is not syntactically valid, it reports an
+// error of concrete type *SyntaxError.
+func ValidateString(s string, tier Tier) error {
+	q, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	return validate(q, s, tier)
+}
+
+func validate(q Query, s string, tier Tier) error {
+	v := &validator{tier: tier}
+	if n, max := utf8.RuneCountInString(s), tier.MaxLength(); n > max {
+		v.report("", "query length %d exceeds the %s limit of %d", n, tier, max)
+	}
+	v.check(q, true)
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return v.problems
+}
+
+type validator struct {
+	tier     Tier
+	problems Problems
+}
+
+func (v *validator) report(term, msg string, args ...interface{}) {
+	v.problems = append(v.problems, &Problem{Term: term, Message: fmt.Sprintf(msg, args...)})
+}
+
+// check checks q and its subqueries. If needStandalone is true, q must contain
+// a standalone term.
+func (v *validator) check(q Query, needStandalone bool) {
+	switch t := q.(type) {
+	case andQuery:
+		if len(t) == 0 {
+			v.report("()", "empty group")
+			return
+		}
+		negated := true
+		for _, sub := range t {
+			if _, ok := sub.(notQuery); !ok {
+				negated = false
+			}
+			v.check(sub, false)
+		}
+		if negated {
+			v.report(t.String(), "group contains only negated terms")
+		} else if needStandalone && !isStandaloneQuery(t) {
+			v.report(t.String(), "group must include a standalone operator")
+		}
+	case orQuery:
+		if len(t) == 0 {
+			v.report("()", "empty group")
+			return
+		}
+		// Each alternative must stand on its own.
+		for _, sub := range t {
+			v.check(sub, needStandalone)
+		}
+	case notQuery:
+		if needStandalone {
+			v.report(t.String(), "negated term must be combined with a standalone operator")
+		}
+		v.check(t.sub, false)
+	case invalid:
+		v.report(t.term, "%v", t.err)
+	case solo, nsolo, quoted:
+		v.checkTerm(q.String())
+		if needStandalone && !isStandaloneQuery(q) {
+			v.report(q.String(), "operator must be combined with a standalone operator")
+		}
+	default:
+		pq, err := Parse(q.String())
+		if err != nil {
+			v.report(q.String(), "invalid query: %v", err)
+			return
+		}
+		v.check(pq, needStandalone)
+	}
+}
+
+// checkTerm checks the operator and value of a single term.
+func (v *validator) checkTerm(term string) {
+	if strings.HasPrefix(term, "$") && len(term) > 1 && v.tier < Elevated {
+		v.report(term, "cashtags require %s access", Elevated)
+		return
+	}
+	name, arg := splitTerm(term)
+	if name == "" {
+		return
+	}
+	op, ok := operators[name]
+	if !ok {
+		v.report(term, "unknown operator %q", name+":")
+		return
+	}
+	arg = strings.Trim(arg, `"`)
+	need := op.tier
+	if op.values != nil {
+		t, ok := op.values[arg]
+		if !ok {
+			v.report(term, "unknown value %q for operator %q", arg, name+":")
+			return
+		}
+		need = t
+	}
+	if v.tier < need {
+		v.report(term, "operator requires %s access", need)
+	}
+	switch name {
+	case "lang":
+		if !langCodes[arg] {
+			v.report(term, "unsupported language code %q", arg)
+		}
+	case "place_country":
+		if err := checkCountry(arg); err != nil {
+			v.report(term, "%v", err)
+		}
+	case "point_radius", "bounding_box":
+		if _, err := parseGeoValue(name, arg); err != nil {
+			v.report(term, "%v", err)
+		}
+	case "sample":
+		if n, err := strconv.Atoi(arg); err != nil || n < 1 || n > 100 {
+			v.report(term, "sample percentage %q must be an integer in [1, 100]", arg)
+		}
+	case "followers_count", "following_count", "tweets_count", "listed_count":
+		if _, _, err := parseCount(arg); err != nil {
+			v.report(term, "%v", err)
+		}
+	}
+}
+
+// isStandaloneQuery reports whether q contains a standalone term in a
+// position that satisfies the requirement for one: some conjunct of a group,
+// or every alternative of a disjunction. Negated terms do not count.
+func isStandaloneQuery(q Query) bool {
+	switch t := q.(type) {
+	case andQuery:
+		for _, sub := range t {
+			if isStandaloneQuery(sub) {
+				return true
+			}
+		}
+		return false
+	case orQuery:
+		for _, sub := range t {
+			if !isStandaloneQuery(sub) {
+				return false
+			}
+		}
+		return len(t) != 0
+	case notQuery:
+		return false
+	default:
+		return q.Valid()
+	}
+}
+
+// langCodes are the language codes accepted by the lang: operator.
+var langCodes = map[string]bool{
+	"am": true, "ar": true, "bg": true, "bn": true, "bo": true, "bs": true,
+	"ca": true, "ckb": true, "cs": true, "cy": true, "da": true, "de": true,
+	"dv": true, "el": true, "en": true, "es": true, "et": true, "eu": true,
+	"fa": true, "fi": true, "fr": true, "gu": true, "hi": true, "hi-Latn": true,
+	"hr": true, "ht": true, "hu": true, "hy": true, "in": true, "is": true,
+	"it": true, "iw": true, "ja": true, "ka": true, "km": true, "kn": true,
+	"ko": true, "lo": true, "lt": true, "lv": true, "ml": true, "mr": true,
+	"my": true, "ne": true, "nl": true, "no": true, "or": true, "pa": true,
+	"pl": true, "ps": true, "pt": true, "ro": true, "ru": true, "sd": true,
+	"si": true, "sk": true, "sl": true, "sr": true, "sv": true, "ta": true,
+	"te": true, "th": true, "tl": true, "tr": true, "ug": true, "uk": true,
+	"ur": true, "vi": true, "zh": true, "zh-CN": true, "zh-TW": true,
+	"und": true,
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package query_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nankys/twitter/query"
+)
+
+func TestValidate(t *testing.T) {
+	long := strings.Repeat("cat ", 200) // 800 characters
+	tests := []struct {
+		input string
+		tier  query.Tier
+		want  []string // terms of the expected problems, in order
+	}{
+		{"cat has:images -is:retweet", query.Essential, nil},
+		{"(cat OR dog) lang:en", query.Essential, nil},
+		{"cat (has:images OR has:videos)", query.Essential, nil},
+		{long, query.Elevated, nil},
+		{long, query.Essential, []string{""}},
+
+		// Conjunction-only operators.
+		{"has:images", query.Essential, []string{"has:images"}},
+		{"has:images lang:en", query.Essential, []string{"has:images lang:en"}},
+		{"cat OR has:images", query.Essential, []string{"has:images"}},
+		{`is:"retweet"`, query.Essential, []string{`is:"retweet"`}},
+		{`lang:"en"`, query.Essential, []string{`lang:"en"`}},
+		{`cat lang:"en"`, query.Essential, nil},
+		{`from:"alice"`, query.Essential, nil},
+
+		// Negation.
+		{"-cat", query.Essential, []string{"-cat"}},
+		{"-cat -dog", query.Essential, []string{"-cat -dog"}},
+		{"bird OR (-cat -dog)", query.Essential, []string{"-cat -dog"}},
+		{"cat OR -dog", query.Essential, []string{"-dog"}},
+
+		// Operator tiers and values.
+		{"cat has:geo", query.Essential, []string{"has:geo"}},
+		{"cat has:geo", query.Elevated, nil},
+		{"$TWTR", query.Essential, []string{"$TWTR"}},
+		{`bio:"cat lover" followers_count:100`, query.Elevated, []string{"followers_count:100"}},
+		{`bio:"cat lover" followers_count:100`, query.Academic, nil},
+		{"cat is:fluffy", query.Academic, []string{"is:fluffy"}},
+		{"cat lang:xx lang:zh-TW", query.Essential, []string{"lang:xx"}},
+		{"cat is:nullcast", query.Essential, []string{"is:nullcast"}},
+		{"list:123 has:cashtags sample:10", query.Elevated, nil},
+		{"list:123 sample:0 sample:x", query.Elevated, []string{"sample:0", "sample:x"}},
+		{"bio_name:alice followers_count:10..5", query.Academic, []string{"followers_count:10..5"}},
+		{"cat tweets_count:10 listed_count:0..3", query.Academic, nil},
+		{"retweets_of_tweet_id:1 OR quotes_of_tweet_id:2 OR in_reply_to_tweet_id:3", query.Essential, nil},
+	}
+	for _, test := range tests {
+		err := query.ValidateString(test.input, test.tier)
+		var got []string
+		var ps query.Problems
+		if errors.As(err, &ps) {
+			for _, p := range ps {
+				got = append(got, p.Term)
+			}
+		} else if err != nil {
+			t.Errorf("ValidateString(%q, %v): unexpected error: %v", test.input, test.tier, err)
+			continue
+		}
+		if !equalStrings(got, test.want) {
+			t.Errorf("ValidateString(%q, %v): got problems %q, want %q (%v)",
+				test.input, test.tier, got, test.want, err)
+		}
+	}
+
+	// Syntax errors are reported as such.
+	var serr *query.SyntaxError
+	if err := query.ValidateString("(cat", query.Academic); !errors.As(err, &serr) {
+		t.Errorf("ValidateString: got %v, want syntax error", err)
+	}
+
+	// Queries from the builder are checked directly.
+	b := query.New()
+	if err := query.Validate(b.Or(), query.Essential); err == nil {
+		t.Error("Validate(empty): got nil, want error")
+	}
+	if err := query.Validate(b.And(b.Word("cat"), b.Not(b.HasImages())), query.Essential); err != nil {
+		t.Errorf("Validate: unexpected error: %v", err)
+	}
+
+	// Validate is stricter than Valid for the alternatives of a disjunction.
+	if q := b.Or(b.Word("cat"), b.HasImages()); !q.Valid() {
+		t.Errorf("Valid(%q): got false, want true", q)
+	} else if err := query.Validate(q, query.Essential); err == nil {
+		t.Errorf("Validate(%q): got nil, want error", q)
+	}
+}
@@ -28,6 +28,9 @@ type Reply struct {
 	// Error details reported with lookup or search replies.
 	Errors []*types.ErrorDetail `json:"errors,omitempty"`
 
+	// For a tweet delivered by a filtered stream, the rules it matched.
+	MatchingRules []*types.MatchingRule `json:"matching_rules,omitempty"`
+
 	// Rate limit metadata reported by the server. If the server did not return
 	// these data, this field will be nil.
 	RateLimit *RateLimit `json:"-"`
@@ -103,6 +106,62 @@ func (r *Reply) IncludedPlaces() (types.Places, error) {
 	return out, nil
 }
 
+// Merge merges the includes and error details of o into r. Included objects
+// already present in r, as identified by their ID or media key, are not
+// duplicated. The other fields of r are not modified.
+func (r *Reply) Merge(o *Reply) error {
+	for kind, data := range o.Includes {
+		merged, err := mergeIncludes(r.Includes[kind], data)
+		if err != nil {
+			return &jhttp.Error{Data: data, Message: "merging " + kind, Err: err}
+		}
+		if r.Includes == nil {
+			r.Includes = make(map[string]json.RawMessage)
+		}
+		r.Includes[kind] = merged
+	}
+	r.Errors = append(r.Errors, o.Errors...)
+	return nil
+}
+
+// mergeIncludes merges two JSON arrays of included objects, omitting objects
+// from the second whose ID or media key appears in the first.
+func mergeIncludes(a, b json.RawMessage) (json.RawMessage, error) {
+	var as, bs []json.RawMessage
+	if len(a) != 0 {
+		if err := json.Unmarshal(a, &as); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(b, &bs); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	objKey := func(obj json.RawMessage) string {
+		var key struct {
+			ID       string `json:"id"`
+			MediaKey string `json:"media_key"`
+		}
+		json.Unmarshal(obj, &key)
+		if key.ID != "" {
+			return "id:" + key.ID
+		} else if key.MediaKey != "" {
+			return "media:" + key.MediaKey
+		}
+		return "" // no identity; do not de-duplicate
+	}
+	for _, obj := range as {
+		seen[objKey(obj)] = true
+	}
+	for _, obj := range bs {
+		if key := objKey(obj); key == "" || !seen[key] {
+			as = append(as, obj)
+			seen[key] = true
+		}
+	}
+	return json.Marshal(as)
+}
+
 // RateLimit records metadata about API rate limits reported by the server.
 type RateLimit struct {
 	Ceiling   int       // rate limit ceiling for this endpoint
@@ -0,0 +1,167 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/creachadair/jhttp"
+)
+
+// A RetryPolicy controls how a client retries calls that fail with a
+// transient error. Transient errors are HTTP 429 (Too Many Requests) and 5xx
+// statuses, and connections reset by the server.
+//
+// A server error or a reset connection does not show whether the server
+// applied the request, so by default these are retried only for idempotent
+// methods (GET, HEAD, OPTIONS, PUT, and DELETE). A POST, such as creating a
+// tweet or adding a rule, is retried only after HTTP 429, since the server
+// does not apply a request it rejects for its rate limit. Set RetryUnsafe to
+// retry all methods.
+//
+// Between attempts the client waits for an exponentially increasing, jittered
+// delay. If the server reports a Retry-After header, or reports that the rate
+// limit for the endpoint is exhausted, the client waits at least until then.
+//
+// A RetryPolicy applies to Call and CallRaw, but not to Stream.
+type RetryPolicy struct {
+	// The maximum number of attempts per call, including the first.
+	// If zero, the default is 3.
+	MaxAttempts int
+
+	// If positive, the maximum total time to spend on a single call, including
+	// all attempts and the delays between them. The client does not begin a
+	// retry that would wait past this deadline.
+	Deadline time.Duration
+
+	// The delay before the first retry. Each subsequent delay is double the
+	// previous one, up to MaxDelay. If zero, the default is 1 second.
+	BaseDelay time.Duration
+
+	// The maximum delay between attempts, not counting delays requested by the
+	// server. If zero, the default is 1 minute.
+	MaxDelay time.Duration
+
+	// If true, retry requests with non-idempotent methods, such as POST, after
+	// any transient error. This may apply the request more than once.
+	RetryUnsafe bool
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) baseDelay() time.Duration {
+	if p.BaseDelay <= 0 {
+		return time.Second
+	}
+	return p.BaseDelay
+}
+
+func (p *RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return time.Minute
+	}
+	return p.MaxDelay
+}
+
+// delay returns how long to wait after the given attempt (numbered from 1)
+// failed with the given response header.
+func (p *RetryPolicy) delay(attempt int, h http.Header) time.Duration {
+	d := p.baseDelay()
+	for i := 1; i < attempt && d < p.maxDelay(); i++ {
+		d *= 2
+	}
+	if d > p.maxDelay() {
+		d = p.maxDelay()
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1)) // jitter
+
+	if hint := serverDelay(h); hint > d {
+		return hint
+	}
+	return d
+}
+
+// call invokes f until it succeeds, fails with a non-transient error, or the
+// policy's attempts or deadline are exhausted. If the policy gives up, call
+// returns the results of the last attempt.
+func (p *RetryPolicy) call(ctx context.Context, req *jhttp.Request, f func(context.Context) (http.Header, []byte, error)) (http.Header, []byte, error) {
+	if p.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Deadline)
+		defer cancel()
+	}
+	for attempt := 1; ; attempt++ {
+		header, body, err := f(ctx)
+		if err == nil || attempt >= p.maxAttempts() || !p.retryable(req, err) {
+			return header, body, err
+		}
+		wait := p.delay(attempt, header)
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) < wait {
+			return header, body, err // not enough time for another attempt
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return header, body, err
+		case <-t.C:
+		}
+	}
+}
+
+// retryable reports whether req should be retried after it failed with err.
+func (p *RetryPolicy) retryable(req *jhttp.Request, err error) bool {
+	var jerr *jhttp.Error
+	if errors.As(err, &jerr) && jerr.Status == http.StatusTooManyRequests {
+		return true // the request was not applied
+	}
+	return isTransient(err) && (p.RetryUnsafe || isIdempotent(req))
+}
+
+// isTransient reports whether err is an error that may succeed on retry.
+func isTransient(err error) bool {
+	var jerr *jhttp.Error
+	if errors.As(err, &jerr) && jerr.Status != 0 {
+		return jerr.Status == http.StatusTooManyRequests || jerr.Status >= 500
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isIdempotent reports whether the HTTP method of req is idempotent.
+func isIdempotent(req *jhttp.Request) bool {
+	switch req.HTTPMethod {
+	case "", "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// serverDelay returns the delay requested by the server in h, or 0 if there
+// is none. A Retry-After header takes precedence over the rate limit reset.
+func serverDelay(h http.Header) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if sec, err := strconv.Atoi(v); err == nil {
+			return time.Duration(sec) * time.Second
+		} else if t, err := http.ParseTime(v); err == nil {
+			return time.Until(t)
+		}
+	}
+	if h.Get("x-rate-limit-remaining") == "0" {
+		if rl := decodeRateLimits(h); !rl.Reset.IsZero() {
+			return time.Until(rl.Reset)
+		}
+	}
+	return 0
+}
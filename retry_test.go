@@ -0,0 +1,131 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+)
+
+// failingServer returns a server that replies with each of the given statuses
+// in turn, and then with success.
+func failingServer(t *testing.T, hdr http.Header, statuses ...int) (*httptest.Server, *int) {
+	t.Helper()
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls <= len(statuses) {
+			for k, vs := range hdr {
+				w.Header()[k] = vs
+			}
+			w.WriteHeader(statuses[calls-1])
+			w.Write([]byte(`{"title":"failed"}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"id":"1"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	req := &jhttp.Request{Method: "2/tweets/1"}
+	fast := &twitter.RetryPolicy{BaseDelay: time.Millisecond}
+
+	t.Run("Transient", func(t *testing.T) {
+		srv, calls := failingServer(t, nil, 503, 429)
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Retry = fast
+		if _, err := cli.Call(ctx, req); err != nil {
+			t.Errorf("Call: unexpected error: %v", err)
+		}
+		if *calls != 3 {
+			t.Errorf("Server saw %d calls, want 3", *calls)
+		}
+	})
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		srv, calls := failingServer(t, nil, 500, 500, 500)
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Retry = &twitter.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+		_, err := cli.Call(ctx, req)
+		var jerr *jhttp.Error
+		if !errors.As(err, &jerr) || jerr.Status != 500 {
+			t.Errorf("Call: got error %v, want status 500", err)
+		}
+		if *calls != 2 {
+			t.Errorf("Server saw %d calls, want 2", *calls)
+		}
+	})
+
+	t.Run("Permanent", func(t *testing.T) {
+		srv, calls := failingServer(t, nil, 404)
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Retry = fast
+		if _, err := cli.Call(ctx, req); err == nil {
+			t.Error("Call: got nil error, want 404")
+		}
+		if *calls != 1 {
+			t.Errorf("Server saw %d calls, want 1", *calls)
+		}
+	})
+
+	t.Run("Unsafe", func(t *testing.T) {
+		post := &jhttp.Request{Method: "2/tweets", HTTPMethod: "POST", Data: []byte(`{"text":"hi"}`)}
+		tests := []struct {
+			name     string
+			statuses []int
+			unsafe   bool
+			calls    int
+		}{
+			{"ServerError", []int{503}, false, 1}, // may have been applied
+			{"RateLimit", []int{429}, false, 2},   // not applied
+			{"OptIn", []int{503}, true, 2},
+		}
+		for _, test := range tests {
+			srv, calls := failingServer(t, nil, test.statuses...)
+			cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+			cli.Retry = &twitter.RetryPolicy{BaseDelay: time.Millisecond, RetryUnsafe: test.unsafe}
+			cli.Call(ctx, post)
+			if *calls != test.calls {
+				t.Errorf("%s: server saw %d calls, want %d", test.name, *calls, test.calls)
+			}
+		}
+	})
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		srv, calls := failingServer(t, http.Header{"Retry-After": {"1"}}, 429)
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Retry = fast
+		start := time.Now()
+		if _, err := cli.Call(ctx, req); err != nil {
+			t.Errorf("Call: unexpected error: %v", err)
+		}
+		if *calls != 2 {
+			t.Errorf("Server saw %d calls, want 2", *calls)
+		}
+		if d := time.Since(start); d < time.Second {
+			t.Errorf("Call returned after %v, want at least 1s", d)
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		srv, calls := failingServer(t, http.Header{"Retry-After": {"30"}}, 429)
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.Retry = &twitter.RetryPolicy{Deadline: time.Second}
+		if _, err := cli.Call(ctx, req); err == nil {
+			t.Error("Call: got nil error, want 429")
+		}
+		if *calls != 1 {
+			t.Errorf("Server saw %d calls, want 1", *calls)
+		}
+	})
+}
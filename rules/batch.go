@@ -0,0 +1,169 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules
+
+import (
+	"context"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/types"
+)
+
+// invokeBatches executes an update query, splitting the rules into batches.
+// If a request fails, it returns the error along with the combined results of
+// the batches already sent.
+func (q Query) invokeBatches(ctx context.Context, cli *twitter.Client) (*Reply, error) {
+	b := &batcher{ctx: ctx, cli: cli, dryRun: q.dryRun, out: &Reply{Meta: new(Meta)}}
+	n, step := q.set.size(), q.batch
+	if step <= 0 || step > n {
+		step = n
+	}
+	for i := 0; i == 0 || i < n; i += step {
+		end := i + step
+		if end > n {
+			end = n
+		}
+		if err := b.run(q.set.slice(i, end)); err != nil {
+			return b.out, err
+		}
+	}
+	return b.out, nil
+}
+
+// A batcher sends batches of rule updates and combines their results.
+type batcher struct {
+	ctx    context.Context
+	cli    *twitter.Client
+	dryRun bool
+	out    *Reply
+}
+
+// run sends a single batch. If the service rejects the batch, run drops the
+// rules named by the errors and sends the rest again. If an error does not
+// identify its rule, run instead splits the batch and retries each half, until
+// the rejected rules are isolated.
+func (b *batcher) run(set Set) error {
+	data, err := set.encode()
+	if err != nil {
+		return &jhttp.Error{Message: "encoding rule set", Err: err}
+	}
+	req := &jhttp.Request{
+		Method:     "2/tweets/search/stream/rules",
+		HTTPMethod: "POST",
+		Data:       data,
+	}
+	if b.dryRun {
+		req.Params = jhttp.Params{"dry_run": []string{"true"}}
+	}
+	rsp, err := invoke(b.ctx, b.cli, req)
+	if err != nil {
+		return err
+	}
+	n := set.size()
+	if n <= 1 || len(rsp.Errors) == 0 {
+		return b.add(set, rsp)
+	} else if m := rsp.Meta; m != nil && (m.Summary.Created != 0 || m.Summary.Deleted != 0) {
+		return b.add(set, rsp) // the service applied the other rules
+	}
+
+	bad := make(map[int]bool)
+	for _, e := range rsp.Errors {
+		i := ruleIndex(set, e)
+		if i < 0 {
+			if err := b.run(set.slice(0, n/2)); err != nil {
+				return err
+			}
+			return b.run(set.slice(n/2, n))
+		}
+		bad[i] = true
+	}
+
+	// Nothing is applied by a dry run, so there is nothing to resend, and
+	// likewise if every rule in the batch was rejected.
+	if b.dryRun || len(bad) == n {
+		return b.add(set, rsp)
+	}
+
+	// Record the rejected rules, and send the rest again. The summary of the
+	// rejected batch counts only the rejected rules, since the others are
+	// counted by the reply to the second request.
+	rej := *rsp
+	if m := rsp.Meta; m != nil {
+		cp := *m
+		cp.Summary.Valid = 0
+		if cp.Summary.NotCreated > len(bad) {
+			cp.Summary.NotCreated = len(bad)
+		}
+		if cp.Summary.NotDeleted > len(bad) {
+			cp.Summary.NotDeleted = len(bad)
+		}
+		rej.Meta = &cp
+	}
+	if err := b.add(set, &rej); err != nil {
+		return err
+	}
+	return b.run(set.omit(bad))
+}
+
+// add combines the results of a batch into the output.
+func (b *batcher) add(set Set, rsp *Reply) error {
+	out := b.out
+	if out.Reply == nil {
+		out.Reply = rsp.Reply
+	} else {
+		if err := out.Reply.Merge(rsp.Reply); err != nil {
+			return err
+		}
+		if rsp.RateLimit != nil {
+			out.RateLimit = rsp.RateLimit
+		}
+	}
+	out.Rules = append(out.Rules, rsp.Rules...)
+	if m := rsp.Meta; m != nil {
+		if m.Sent.After(out.Meta.Sent) {
+			out.Meta.Sent = m.Sent
+		}
+		sum := &out.Meta.Summary
+		sum.Created += m.Summary.Created
+		sum.NotCreated += m.Summary.NotCreated
+		sum.Deleted += m.Summary.Deleted
+		sum.NotDeleted += m.Summary.NotDeleted
+		sum.Valid += m.Summary.Valid
+		sum.Invalid += m.Summary.Invalid
+	}
+
+	// Attribute the errors to the rules they describe. Errors that do not
+	// identify a rule are attributed to the only rule in a batch of one.
+	failed := make(map[int]int) // rule index → index in out.Failed
+	for _, e := range rsp.Errors {
+		i := ruleIndex(set, e)
+		if i < 0 && set.size() == 1 {
+			i = 0
+		} else if i < 0 {
+			continue
+		}
+		if _, ok := failed[i]; !ok {
+			failed[i] = len(out.Failed)
+			out.Failed = append(out.Failed, Failure{Rule: set.rule(i)})
+		}
+		f := &out.Failed[failed[i]]
+		f.Errors = append(f.Errors, e)
+	}
+	return nil
+}
+
+// ruleIndex returns the index of the rule in set that e describes, or -1 if
+// e does not describe exactly one rule of the set.
+func ruleIndex(set Set, e *types.ErrorDetail) int {
+	idx := -1
+	for i := 0; i < set.size(); i++ {
+		if !set.matches(i, e) {
+			continue
+		} else if idx >= 0 {
+			return -1 // ambiguous
+		}
+		idx = i
+	}
+	return idx
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/rules"
+	"github.com/nankys/twitter/twittertest"
+)
+
+func TestBatches(t *testing.T) {
+	srv := twittertest.NewServer(&twittertest.Seed{MaxRules: 100, MaxRuleBatch: 4})
+	defer srv.Close()
+	cli := srv.Client()
+	ctx := context.Background()
+
+	var adds rules.Adds
+	for i := 0; i < 10; i++ {
+		adds = append(adds, rules.Add{Query: fmt.Sprintf("word%d", i), Tag: fmt.Sprint(i)})
+	}
+	adds[3].Query = "(bad"
+	adds[8].Query = "bogus:value"
+
+	// Without batching, the request exceeds the per-request limit.
+	if rsp, err := rules.Update(adds).BatchSize(0).Invoke(ctx, cli); err == nil {
+		t.Fatalf("Update: got %+v, want error", rsp)
+	}
+
+	// Validation reports the invalid rules without changing anything.
+	vrs, err := rules.Validate(adds).BatchSize(4).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if s := vrs.Meta.Summary; s.Valid != 8 || s.Invalid != 2 {
+		t.Errorf("Validate summary: got %+v, want 8 valid, 2 invalid", s)
+	}
+	checkFailed(t, vrs, "(bad", "bogus:value")
+	if got := srv.Rules(); len(got) != 0 {
+		t.Errorf("Rules after validation: got %+v, want none", got)
+	}
+
+	// The update applies the valid rules, and isolates the invalid ones.
+	rsp, err := rules.Update(adds).BatchSize(4).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if s := rsp.Meta.Summary; s.Created != 8 || s.NotCreated != 2 {
+		t.Errorf("Update summary: got %+v, want 8 created, 2 not created", s)
+	}
+	checkFailed(t, rsp, "(bad", "bogus:value")
+	if len(rsp.Rules) != 8 || len(srv.Rules()) != 8 {
+		t.Errorf("Created rules: got %+v, want 8", rsp.Rules)
+	}
+	if len(rsp.Errors) != 2 {
+		t.Errorf("Errors: got %d, want 2", len(rsp.Errors))
+	}
+
+	// Deletions are batched the same way.
+	dels := rules.Deletes{"nonesuch"}
+	for _, r := range rsp.Rules {
+		dels = append(dels, r.ID)
+	}
+	drs, err := rules.Update(dels).BatchSize(4).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if s := drs.Meta.Summary; s.Deleted != 8 || s.NotDeleted != 1 {
+		t.Errorf("Delete summary: got %+v, want 8 deleted, 1 not deleted", s)
+	}
+	if len(drs.Failed) != 1 || drs.Failed[0].Rule.ID != "nonesuch" {
+		t.Errorf("Delete failures: got %+v, want nonesuch", drs.Failed)
+	}
+	if got := srv.Rules(); len(got) != 0 {
+		t.Errorf("Rules after delete: got %+v, want none", got)
+	}
+}
+
+func TestBatchResend(t *testing.T) {
+	srv := twittertest.NewServer(&twittertest.Seed{MaxRules: 200, MaxRuleBatch: 100})
+	defer srv.Close()
+	var rt countTransport
+	cli := twitter.NewClient(&jhttp.Client{
+		BaseURL:    srv.URL,
+		HTTPClient: &http.Client{Transport: &rt},
+	})
+	ctx := context.Background()
+
+	var adds rules.Adds
+	for i := 0; i < 64; i++ {
+		adds = append(adds, rules.Add{Query: fmt.Sprintf("word%d", i)})
+	}
+	if _, err := rules.Update(adds).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Every error names its rule, so the duplicates are dropped and the new
+	// rule is sent again in one request, rather than bisecting the batch.
+	atomic.StoreInt32(&rt.n, 0)
+	again := append(adds[:len(adds):len(adds)], rules.Add{Query: "novel"})
+	rsp, err := rules.Update(again).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&rt.n); n != 2 {
+		t.Errorf("Update sent %d requests, want 2", n)
+	}
+	if s := rsp.Meta.Summary; s.Created != 1 || s.NotCreated != 64 {
+		t.Errorf("Update summary: got %+v, want 1 created, 64 not created", s)
+	}
+	if len(rsp.Failed) != 64 || len(rsp.Rules) != 1 || rsp.Rules[0].Value != "novel" {
+		t.Errorf("Update: got %d failed, rules %+v; want 64 failed, novel", len(rsp.Failed), rsp.Rules)
+	}
+	if got := srv.Rules(); len(got) != 65 {
+		t.Errorf("Rules: got %d, want 65", len(got))
+	}
+
+	// If every rule is rejected, there is nothing to send again.
+	atomic.StoreInt32(&rt.n, 0)
+	if _, err := rules.Update(adds).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&rt.n); n != 1 {
+		t.Errorf("Update sent %d requests, want 1", n)
+	}
+}
+
+// countTransport counts the requests sent through the default transport.
+type countTransport struct{ n int32 }
+
+func (c *countTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.n, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func checkFailed(t *testing.T, rsp *rules.Reply, want ...string) {
+	t.Helper()
+	var got []string
+	for _, f := range rsp.Failed {
+		if len(f.Errors) == 0 {
+			t.Errorf("Failure %+v has no errors", f.Rule)
+		}
+		got = append(got, f.Rule.Value)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Failed rules: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+)
+
+// A Journal is a local, append-only record of changes to the stream rules,
+// stored as a file of JSON lines. A Journal is safe for concurrent use.
+//
+// To record every change applied by a client, add the journal interceptor to
+// the client:
+//
+//	j := rules.NewJournal("rules.jsonl", "deploy-bot")
+//	cli.Interceptors = append(cli.Interceptors, j.Interceptor())
+//
+// Entries are identified by their position in the journal, starting from 1.
+// The state of the rules after each entry is reconstructed from the most
+// recent snapshot of the complete rule set, and the changes that follow it.
+// Position 0, and any position before the first snapshot, represent an empty
+// rule set; use Snapshot to record the existing rules when starting a journal
+// for an account that already has rules.
+type Journal struct {
+	Actor string // the actor recorded for each change
+
+	path string
+	mu   sync.Mutex
+}
+
+// NewJournal returns a Journal that records changes in the file at path,
+// attributed to the given actor. The file is created when the first entry is
+// recorded.
+func NewJournal(path, actor string) *Journal { return &Journal{Actor: actor, path: path} }
+
+// An Entry is a single record in a Journal.
+type Entry struct {
+	Kind  string    `json:"kind"` // "update" or "snapshot"
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor,omitempty"`
+
+	// For an update, the rules to be added or deleted, as sent to the service,
+	// and the rules it created.
+	Adds    []Rule   `json:"adds,omitempty"`
+	Deletes []string `json:"deletes,omitempty"`
+	Created []Rule   `json:"created,omitempty"`
+	Summary *Summary `json:"summary,omitempty"`
+
+	// For a snapshot, the complete set of active rules.
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Kinds of journal entries.
+const (
+	EntryUpdate   = "update"
+	EntrySnapshot = "snapshot"
+)
+
+// Interceptor returns a client interceptor that records in j each rule update
+// that is sent to the service, other than dry runs. If the entry cannot be
+// recorded, the interceptor reports an error to the caller even though the
+// update was applied.
+func (j *Journal) Interceptor() twitter.Interceptor {
+	return func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+		err := next(ctx, ex)
+		req := ex.Request
+		if err != nil || ex.Kind != twitter.KindCall || ex.Reply == nil ||
+			req.Method != "2/tweets/search/stream/rules" || req.HTTPMethod != "POST" ||
+			isDryRun(req) {
+			return err
+		}
+		e, err := updateEntry(req.Data, ex.Reply)
+		if err != nil {
+			return &jhttp.Error{Data: req.Data, Message: "decoding rule update", Err: err}
+		}
+		return j.append(e)
+	}
+}
+
+func isDryRun(req *jhttp.Request) bool {
+	v := req.Params["dry_run"]
+	return len(v) != 0 && v[0] == "true"
+}
+
+func updateEntry(data []byte, rsp *twitter.Reply) (*Entry, error) {
+	var req struct {
+		Add    []Rule `json:"add"`
+		Delete struct {
+			IDs []string `json:"ids"`
+		} `json:"delete"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	e := &Entry{Kind: EntryUpdate, Adds: req.Add, Deletes: req.Delete.IDs}
+	if len(rsp.Data) != 0 {
+		if err := json.Unmarshal(rsp.Data, &e.Created); err != nil {
+			return nil, err
+		}
+	}
+	if len(rsp.Meta) != 0 {
+		var meta Meta
+		if err := json.Unmarshal(rsp.Meta, &meta); err != nil {
+			return nil, err
+		}
+		e.Summary = &meta.Summary
+	}
+	return e, nil
+}
+
+// Snapshot fetches the active rules and records them in j.
+func (j *Journal) Snapshot(ctx context.Context, cli *twitter.Client) error {
+	rsp, err := Get().Invoke(ctx, cli)
+	if err != nil {
+		return err
+	}
+	return j.append(&Entry{Kind: EntrySnapshot, Rules: rsp.Rules})
+}
+
+func (j *Journal) append(e *Entry) error {
+	e.Time = time.Now().UTC()
+	e.Actor = j.Actor
+	data, err := json.Marshal(e)
+	if err != nil {
+		return &jhttp.Error{Message: "encoding journal entry", Err: err}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return &jhttp.Error{Message: "opening journal", Err: err}
+	}
+	_, werr := f.Write(append(data, '\n'))
+	cerr := f.Close()
+	if werr != nil {
+		return &jhttp.Error{Message: "writing journal", Err: werr}
+	} else if cerr != nil {
+		return &jhttp.Error{Message: "writing journal", Err: cerr}
+	}
+	return nil
+}
+
+// Entries returns the entries of j, in order. If the journal file does not
+// exist, Entries returns no entries without error.
+func (j *Journal) Entries() ([]*Entry, error) {
+	j.mu.Lock()
+	data, err := os.ReadFile(j.path)
+	j.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, &jhttp.Error{Message: "reading journal", Err: err}
+	}
+	var out []*Entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		e := new(Entry)
+		if err := json.Unmarshal(sc.Bytes(), e); err != nil {
+			return nil, &jhttp.Error{Data: sc.Bytes(), Message: fmt.Sprintf("decoding journal line %d", line), Err: err}
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// State returns the rules that were active after the entry at position pos.
+func (j *Journal) State(pos int) ([]Rule, error) {
+	es, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return stateAt(es, pos)
+}
+
+func stateAt(es []*Entry, pos int) ([]Rule, error) {
+	if pos < 0 || pos > len(es) {
+		return nil, fmt.Errorf("journal position %d out of range [0, %d]", pos, len(es))
+	}
+	var out []Rule
+	for _, e := range es[:pos] {
+		switch e.Kind {
+		case EntrySnapshot:
+			out = append([]Rule(nil), e.Rules...)
+		case EntryUpdate:
+			del := make(map[string]bool)
+			for _, id := range e.Deletes {
+				del[id] = true
+			}
+			keep := out[:0]
+			for _, r := range out {
+				if !del[r.ID] {
+					keep = append(keep, r)
+				}
+			}
+			out = append(keep, e.Created...)
+		}
+	}
+	return out, nil
+}
+
+// A Diff describes the differences between two rule sets. Rules are compared
+// by their tags and normalized queries, as for Sync.
+type Diff struct {
+	Added   []Rule // rules in the later set but not the earlier
+	Removed []Rule // rules in the earlier set but not the later
+}
+
+// Diff reports the differences between the rules that were active after the
+// entries at positions from and to.
+func (j *Journal) Diff(from, to int) (*Diff, error) {
+	es, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	a, err := stateAt(es, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := stateAt(es, to)
+	if err != nil {
+		return nil, err
+	}
+	return &Diff{Added: missing(b, a), Removed: missing(a, b)}, nil
+}
+
+// missing returns the rules of rs that have no equivalent in other.
+func missing(rs, other []Rule) []Rule {
+	have := make(map[string]bool)
+	for _, r := range other {
+		have[ruleKey(r.Value, r.Tag)] = true
+	}
+	var out []Rule
+	for _, r := range rs {
+		if !have[ruleKey(r.Value, r.Tag)] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Rollback makes the active rules match those that were active after the
+// entry at position pos, using Sync. If j records the changes made by cli,
+// the rollback is itself recorded.
+func (j *Journal) Rollback(ctx context.Context, cli *twitter.Client, pos int) (*SyncReport, error) {
+	rs, err := j.State(pos)
+	if err != nil {
+		return nil, &jhttp.Error{Message: "rolling back rules", Err: err}
+	}
+	desired := make(Adds, len(rs))
+	for i, r := range rs {
+		desired[i] = Add{Query: r.Value, Tag: r.Tag}
+	}
+	return Sync(desired).Invoke(ctx, cli)
+}
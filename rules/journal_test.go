@@ -0,0 +1,100 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules_test
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/nankys/twitter/rules"
+	"github.com/nankys/twitter/twittertest"
+)
+
+func TestJournal(t *testing.T) {
+	srv := twittertest.NewServer(nil)
+	defer srv.Close()
+	cli := srv.Client()
+	ctx := context.Background()
+
+	// Rules created before the journal starts are captured by a snapshot.
+	if _, err := rules.Update(rules.Adds{{Query: "cat", Tag: "cats"}}).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	j := rules.NewJournal(filepath.Join(t.TempDir(), "rules.jsonl"), "tester")
+	cli.Interceptors = append(cli.Interceptors, j.Interceptor())
+	if err := j.Snapshot(ctx, cli); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// 2: Add two rules; validation is not recorded.
+	adds := rules.Adds{{Query: "dog", Tag: "dogs"}, {Query: "bird", Tag: "birds"}}
+	if _, err := rules.Validate(adds).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	rsp, err := rules.Update(adds).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	// 3: Delete one of them.
+	if _, err := rules.Update(rules.Deletes{rsp.Rules[0].ID}).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	es, err := j.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(es) != 3 {
+		t.Fatalf("Entries: got %d, want 3", len(es))
+	}
+	if e := es[0]; e.Kind != rules.EntrySnapshot || len(e.Rules) != 1 {
+		t.Errorf("Entry 1: got %+v, want snapshot of 1 rule", e)
+	}
+	if e := es[1]; e.Kind != rules.EntryUpdate || e.Actor != "tester" || e.Time.IsZero() ||
+		len(e.Adds) != 2 || len(e.Created) != 2 || e.Summary == nil || e.Summary.Created != 2 {
+		t.Errorf("Entry 2: got %+v, want update creating 2 rules", e)
+	}
+	if e := es[2]; len(e.Deletes) != 1 || e.Summary == nil || e.Summary.Deleted != 1 {
+		t.Errorf("Entry 3: got %+v, want update deleting 1 rule", e)
+	}
+
+	diff, err := j.Diff(1, 3)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Tag != "birds" || len(diff.Removed) != 0 {
+		t.Errorf("Diff(1, 3): got %+v, want birds added", diff)
+	}
+	diff, err = j.Diff(3, 0)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diff.Added) != 0 || len(diff.Removed) != 2 {
+		t.Errorf("Diff(3, 0): got %+v, want 2 removed", diff)
+	}
+	if _, err := j.Diff(0, 4); err == nil {
+		t.Error("Diff(0, 4): got nil, want error")
+	}
+
+	// Roll back to the state after the rules were added. The rollback is
+	// itself recorded.
+	if _, err := j.Rollback(ctx, cli, 2); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	var tags []string
+	for _, r := range srv.Rules() {
+		tags = append(tags, r.Tag)
+	}
+	sort.Strings(tags)
+	if len(tags) != 3 || tags[0] != "birds" || tags[1] != "cats" || tags[2] != "dogs" {
+		t.Errorf("Rules after rollback: got tags %q, want birds, cats, dogs", tags)
+	}
+	if es, err := j.Entries(); err != nil || len(es) != 4 {
+		t.Errorf("Entries after rollback: got %d, %v; want 4", len(es), err)
+	}
+	if diff, err := j.Diff(2, 4); err != nil || len(diff.Added)+len(diff.Removed) != 0 {
+		t.Errorf("Diff(2, 4): got %+v, %v; want no differences", diff, err)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nankys/twitter/query"
+)
+
+// A KeywordSet is a list of terms to be matched by stream rules, any of which
+// may match, along with a tag to identify the rules that match them.
+type KeywordSet struct {
+	Tag   string   // the tag for each rule from the set (required)
+	Terms []string // keywords, phrases, or other terms; phrases are quoted
+
+	// Constraints shared by each rule from the set, such as "lang:en
+	// -is:retweet". If empty, the terms alone are matched.
+	Constraints string
+}
+
+// A Planner packs keyword sets into stream rules, using as few rules as
+// possible within the limits of an account. A zero Planner is ready for use.
+type Planner struct {
+	MaxLength int // the maximum length of a rule, in characters; if 0, 1024
+	MaxRules  int // the maximum number of rules; if 0, no limit
+}
+
+// A Plan describes the rules needed to match a collection of keyword sets.
+type Plan struct {
+	Keep    []Rule  // active rules that remain as they are
+	Deletes Deletes // IDs of active rules to delete
+	Adds    Adds    // rules to add
+
+	// The complete rules for each tag, both kept and added.
+	ByTag map[string]Adds
+}
+
+// Plan packs the terms of the given keyword sets into rules, each of which
+// combines a disjunction of terms with the constraints of its set.
+//
+// The active rules are those previously created from a plan. An active rule
+// is kept if its terms all still belong to the set with its tag, with the
+// same constraints; only the remaining terms are packed into new rules. In
+// this way, a change to a set replaces only the rules that it affects, and
+// untouched rules keep their IDs. Active rules that are not kept are deleted.
+// To repack every set from scratch, pass no active rules and delete all the
+// existing rules.
+//
+// Plan reports an error if a tag is empty or repeated, if a term does not fit
+// in a rule by itself, or if the plan requires more than MaxRules rules. In
+// the last case, the plan is returned along with the error.
+func (p Planner) Plan(sets []KeywordSet, active []Rule) (*Plan, error) {
+	maxLen := p.MaxLength
+	if maxLen <= 0 {
+		maxLen = query.Elevated.MaxLength()
+	}
+	byTag := make(map[string]*packSet)
+	var order []*packSet
+	for _, ks := range sets {
+		if ks.Tag == "" {
+			return nil, errors.New("keyword set has no tag")
+		} else if byTag[ks.Tag] != nil {
+			return nil, fmt.Errorf("duplicate keyword set tag %q", ks.Tag)
+		}
+		ps := newPackSet(ks)
+		byTag[ks.Tag] = ps
+		order = append(order, ps)
+	}
+
+	out := &Plan{ByTag: make(map[string]Adds)}
+	for _, r := range active {
+		ps := byTag[r.Tag]
+		if ps != nil && utf8.RuneCountInString(r.Value) <= maxLen && ps.claim(r.Value) {
+			out.Keep = append(out.Keep, r)
+			out.ByTag[r.Tag] = append(out.ByTag[r.Tag], Add{Query: r.Value, Tag: r.Tag})
+		} else {
+			out.Deletes = append(out.Deletes, r.ID)
+		}
+	}
+	for _, ps := range order {
+		adds, err := ps.pack(maxLen)
+		if err != nil {
+			return nil, err
+		}
+		out.Adds = append(out.Adds, adds...)
+		out.ByTag[ps.tag] = append(out.ByTag[ps.tag], adds...)
+	}
+	if n := len(out.Keep) + len(out.Adds); p.MaxRules > 0 && n > p.MaxRules {
+		return out, fmt.Errorf("plan requires %d rules, more than the limit of %d", n, p.MaxRules)
+	}
+	return out, nil
+}
+
+// A packSet tracks the terms of a keyword set during planning.
+type packSet struct {
+	tag   string
+	cons  string          // the rendered constraints, or ""
+	terms map[string]bool // rendered term → whether it is covered by a rule
+	list  []string        // rendered terms, in order of appearance
+}
+
+func newPackSet(ks KeywordSet) *packSet {
+	ps := &packSet{tag: ks.Tag, terms: make(map[string]bool)}
+	if c := strings.TrimSpace(ks.Constraints); c != "" {
+		if hasTopLevelOr(c) {
+			c = "(" + c + ")"
+		}
+		ps.cons = c
+	}
+	var b query.Builder
+	for _, t := range ks.Terms {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		term := b.Word(t).String()
+		if _, ok := ps.terms[term]; !ok {
+			ps.terms[term] = false
+			ps.list = append(ps.list, term)
+		}
+	}
+	return ps
+}
+
+// render returns the rule for the given terms of ps.
+func (ps *packSet) render(terms []string) string {
+	s := strings.Join(terms, " OR ")
+	if ps.cons == "" {
+		return s
+	} else if len(terms) > 1 {
+		s = "(" + s + ")"
+	}
+	return s + " " + ps.cons
+}
+
+// claim reports whether value is a rule for uncovered terms of ps, and if so
+// marks those terms as covered.
+func (ps *packSet) claim(value string) bool {
+	body := value
+	if ps.cons != "" {
+		body = strings.TrimSuffix(body, " "+ps.cons)
+		if strings.HasPrefix(body, "(") && strings.HasSuffix(body, ")") {
+			body = body[1 : len(body)-1]
+		}
+	}
+	terms := splitOr(body)
+	for i, t := range terms {
+		covered, ok := ps.terms[t]
+		if !ok || covered {
+			return false
+		}
+		for _, u := range terms[:i] {
+			if u == t {
+				return false
+			}
+		}
+	}
+	if len(terms) == 0 || ps.render(terms) != value {
+		return false
+	}
+	for _, t := range terms {
+		ps.terms[t] = true
+	}
+	return true
+}
+
+// pack packs the uncovered terms of ps into rules no longer than maxLen,
+// using first-fit decreasing.
+func (ps *packSet) pack(maxLen int) (Adds, error) {
+	var todo []string
+	for _, t := range ps.list {
+		if !ps.terms[t] {
+			todo = append(todo, t)
+		}
+	}
+	size := func(s string) int { return utf8.RuneCountInString(s) }
+	sort.SliceStable(todo, func(i, j int) bool { return size(todo[i]) > size(todo[j]) })
+
+	// The length of a rule with n terms of total length sum.
+	ruleLen := func(n, sum int) int {
+		total := sum + 4*(n-1) // " OR "
+		if ps.cons != "" {
+			if n > 1 {
+				total += 2 // parentheses
+			}
+			total += 1 + size(ps.cons)
+		}
+		return total
+	}
+	type bin struct {
+		terms []string
+		sum   int
+	}
+	var bins []*bin
+next:
+	for _, t := range todo {
+		n := size(t)
+		for _, b := range bins {
+			if ruleLen(len(b.terms)+1, b.sum+n) <= maxLen {
+				b.terms = append(b.terms, t)
+				b.sum += n
+				continue next
+			}
+		}
+		if ruleLen(1, n) > maxLen {
+			return nil, fmt.Errorf("term %q of set %q does not fit in a rule of length %d", t, ps.tag, maxLen)
+		}
+		bins = append(bins, &bin{terms: []string{t}, sum: n})
+	}
+
+	adds := make(Adds, len(bins))
+	for i, b := range bins {
+		adds[i] = Add{Query: ps.render(b.terms), Tag: ps.tag}
+	}
+	return adds, nil
+}
+
+// splitOr splits s at occurrences of " OR " outside quotation marks.
+func splitOr(s string) []string {
+	var out []string
+	var quoted bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			quoted = !quoted
+		} else if !quoted && strings.HasPrefix(s[i:], " OR ") {
+			out = append(out, s[start:i])
+			start = i + len(" OR ")
+			i = start - 1
+		}
+	}
+	if s != "" {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+// hasTopLevelOr reports whether s contains an OR outside parentheses and
+// quotation marks.
+func hasTopLevelOr(s string) bool {
+	var depth int
+	var quoted bool
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], " OR "):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/rules"
+)
+
+func TestPlanner(t *testing.T) {
+	var terms []string
+	for i := 0; i < 30; i++ {
+		terms = append(terms, fmt.Sprintf("term%02d", i))
+	}
+	sets := []rules.KeywordSet{{
+		Tag:         "terms",
+		Terms:       append(terms, "term00", " "), // duplicates and blanks are ignored
+		Constraints: "lang:en -is:retweet",
+	}, {
+		Tag:   "phrases",
+		Terms: []string{"guinea pig", "cat", "hot dog"},
+	}}
+	p := rules.Planner{MaxLength: 64}
+
+	plan, err := p.Plan(sets, nil)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(plan.Keep) != 0 || len(plan.Deletes) != 0 {
+		t.Errorf("Plan: got keep %v, deletes %v; want none", plan.Keep, plan.Deletes)
+	}
+	// A rule holds at most 4 terms, since 5 would need (5*6 + 4*4 + 2) + 1 +
+	// 19 = 68 characters.
+	if got := len(plan.ByTag["terms"]); got != 8 {
+		t.Errorf("Plan: got %d rules for terms, want 8", got)
+	}
+	want := []string{`"guinea pig" OR "hot dog" OR cat`}
+	if got := ruleValues(plan.ByTag["phrases"]); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Plan: got phrases %q, want %q", got, want)
+	}
+	checkPlan(t, plan.Adds, 64, terms)
+
+	// Simulate creating the rules, then remove one term and add another.
+	var active []rules.Rule
+	for i, a := range plan.Adds {
+		active = append(active, rules.Rule{ID: fmt.Sprint(i + 1), Value: a.Query, Tag: a.Tag})
+	}
+	sets[0].Terms = append(terms[1:], "term99")
+	plan, err = p.Plan(sets, active)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(plan.Deletes) != 1 || len(plan.Keep) != len(active)-1 {
+		t.Errorf("Replan: got %d kept, deletes %v; want %d kept, 1 delete",
+			len(plan.Keep), plan.Deletes, len(active)-1)
+	}
+	for _, r := range plan.Keep {
+		if strings.Contains(r.Value, "term00") {
+			t.Errorf("Replan kept rule %+v containing a removed term", r)
+		}
+	}
+	var all rules.Adds
+	for _, r := range plan.Keep {
+		if r.Tag == "terms" {
+			all = append(all, rules.Add{Query: r.Value, Tag: r.Tag})
+		}
+	}
+	checkPlan(t, append(all, plan.Adds...), 64, sets[0].Terms)
+
+	// Changing the constraints of a set replaces its rules; removing a set
+	// deletes its rules.
+	plan, err = p.Plan([]rules.KeywordSet{{
+		Tag: "terms", Terms: terms, Constraints: "lang:en OR lang:fr",
+	}}, active)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(plan.Keep) != 0 || len(plan.Deletes) != len(active) {
+		t.Errorf("Replan: got %d kept, %d deleted; want 0 kept, %d deleted",
+			len(plan.Keep), len(plan.Deletes), len(active))
+	}
+	for _, a := range plan.Adds {
+		if !strings.HasSuffix(a.Query, " (lang:en OR lang:fr)") {
+			t.Errorf("Rule %q: constraints not grouped", a.Query)
+		}
+	}
+
+	// Errors.
+	for _, test := range []struct {
+		p    rules.Planner
+		sets []rules.KeywordSet
+	}{
+		{p, []rules.KeywordSet{{Terms: terms}}},
+		{p, []rules.KeywordSet{{Tag: "a"}, {Tag: "a"}}},
+		{p, []rules.KeywordSet{{Tag: "a", Terms: []string{strings.Repeat("x", 65)}}}},
+		{rules.Planner{MaxLength: 64, MaxRules: 3}, sets},
+	} {
+		if plan, err := test.p.Plan(test.sets, nil); err == nil {
+			t.Errorf("Plan(%+v): got %+v, want error", test.sets, plan)
+		}
+	}
+}
+
+func TestPlannerDefault(t *testing.T) {
+	var terms []string
+	for i := 0; i < 200; i++ {
+		terms = append(terms, fmt.Sprintf("term%03d", i))
+	}
+
+	// A zero Planner packs rules up to the Elevated limit of 1024 characters.
+	var p rules.Planner
+	plan, err := p.Plan([]rules.KeywordSet{{Tag: "terms", Terms: terms}}, nil)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	longest := 0
+	for _, a := range plan.Adds {
+		if n := utf8.RuneCountInString(a.Query); n > longest {
+			longest = n
+		}
+	}
+	if got := len(plan.Adds); got != 3 || longest <= 1000 {
+		t.Errorf("Plan: got %d rules of at most %d characters, want 3 of about 1024", got, longest)
+	}
+	checkPlan(t, plan.Adds, query.Elevated.MaxLength(), terms)
+}
+
+// checkPlan verifies that adds are valid rules of at most maxLen characters,
+// which together contain each of the terms exactly once.
+func checkPlan(t *testing.T, adds rules.Adds, maxLen int, terms []string) {
+	t.Helper()
+	count := make(map[string]int)
+	for _, a := range adds {
+		if n := utf8.RuneCountInString(a.Query); n > maxLen {
+			t.Errorf("Rule %q has length %d > %d", a.Query, n, maxLen)
+		}
+		if err := query.ValidateString(a.Query, query.Elevated); err != nil {
+			t.Errorf("Rule %q is invalid: %v", a.Query, err)
+		}
+		for _, w := range strings.Fields(strings.Trim(a.Query, "()")) {
+			count[strings.Trim(w, "()")]++
+		}
+	}
+	for _, term := range terms {
+		if count[term] != 1 {
+			t.Errorf("Term %q appears in %d rules, want 1", term, count[term])
+		}
+	}
+}
+
+func ruleValues(adds rules.Adds) []string {
+	var out []string
+	for _, a := range adds {
+		out = append(out, a.Query)
+	}
+	return out
+}
@@ -36,12 +36,62 @@
 //	apply := rules.Update(adds)
 //	check := rules.Validate(dels)
 //
+// To catch problems before spending a request, check the rules locally for
+// your access tier:
+//
+//	if errs := adds.Check(query.Elevated); errs != nil {
+//	   ...
+//	}
+//
 // Invoke the query to execute the change or check:
 //
 //	rsp, err := apply.Invoke(ctx, cli)
 //
 // The response will include the updated rules, along with server metadata
 // indicating the effective time of application and summary statistics.
+//
+// Large sets are sent in batches of at most MaxBatch rules. The service
+// rejects a batch that contains an invalid rule, so the rules named by the
+// errors for a rejected batch are dropped and the rest are sent again. If the
+// errors do not identify their rules, the batch is split to isolate them. The
+// Failed field of the reply lists the rejected rules and the reasons given for
+// each.
+//
+// # Synchronizing Rules
+//
+// To manage rules as configuration, use rules.Sync to make the active rules
+// match a desired set. Sync compares the rules by tag and normalized query,
+// and deletes and adds only those that differ:
+//
+//	rep, err := rules.Sync(rules.Adds{
+//	   {Query: `cat has:images lang:en`, Tag: "cats"},
+//	   {Query: `dog OR puppy has:images`, Tag: "dogs"},
+//	}).Invoke(ctx, cli)
+//
+// # Planning Rules
+//
+// To match long lists of keywords within the limits on the number and length
+// of rules, use a Planner to pack them into as few rules as possible:
+//
+//	plan, err := rules.Planner{MaxLength: 1024}.Plan([]rules.KeywordSet{{
+//	   Tag:         "pets",
+//	   Terms:       []string{"cat", "dog", "guinea pig", ...},
+//	   Constraints: "lang:en -is:retweet",
+//	}}, active)
+//
+// Given the active rules from an earlier plan, the planner replaces only the
+// rules affected by a change, so the rest keep their IDs.
+//
+// # Rule History
+//
+// A Journal keeps a local history of the rule changes made by a client, which
+// can be used to compare rule sets over time and to roll back to an earlier
+// rule set:
+//
+//	j := rules.NewJournal("rules.jsonl", "deploy-bot")
+//	cli.Interceptors = append(cli.Interceptors, j.Interceptor())
+//	...
+//	rep, err := j.Rollback(ctx, cli, pos)
 package rules
 
 import (
@@ -51,6 +101,8 @@ import (
 
 	"github.com/creachadair/jhttp"
 	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/types"
 )
 
 // Get constructs a query to fetch the specified streaming search rule IDs.  If
@@ -67,49 +119,61 @@ func Get(ids ...string) Query {
 
 // Update constructs a query to add or delete streaming search rules.
 //
+// The rules are sent in batches of at most MaxBatch rules. If the service
+// rejects a batch, the rules named by its errors are dropped and the rest of
+// the batch is sent again. If an error does not identify a single rule of the
+// batch, the batch is instead split in half and each half is retried, until
+// the invalid rules are isolated. The rejected rules are reported in the
+// Failed field of the reply, and the other rules are applied.
+//
 // API: POST 2/tweets/search/stream/rules
-func Update(r Set) Query {
-	enc, err := r.encode()
-	req := &jhttp.Request{
-		Method:     "2/tweets/search/stream/rules",
-		HTTPMethod: "POST",
-		Data:       enc,
-	}
-	return Query{request: req, encodeErr: err}
-}
+func Update(r Set) Query { return Query{set: r, batch: MaxBatch} }
 
 // Validate constructs a query to validate addition or deletion of streaming
-// search rules, without actually modifying the rules.
+// search rules, without actually modifying the rules. The rules are sent in
+// batches as for Update.
 //
 // API: POST 2/tweets/search/stream/rules, dry_run=true
-func Validate(r Set) Query {
-	enc, err := r.encode()
-	req := &jhttp.Request{
-		Method:     "2/tweets/search/stream/rules",
-		HTTPMethod: "POST",
-		Params:     jhttp.Params{"dry_run": []string{"true"}},
-		Data:       enc,
-	}
-	return Query{request: req, encodeErr: err}
-}
+func Validate(r Set) Query { return Query{set: r, dryRun: true, batch: MaxBatch} }
+
+// MaxBatch is the default maximum number of rules sent in a single update
+// request. Use the BatchSize method of a Query to change it.
+const MaxBatch = 1000
 
 // A Query performs a rule fetch or update query.
 type Query struct {
-	request   *jhttp.Request
-	encodeErr error // an error from encoding the rules
+	request *jhttp.Request // for fetch queries
+
+	// For update queries.
+	set    Set
+	dryRun bool
+	batch  int
 }
 
+// BatchSize returns a copy of q that sends at most n rules in each update
+// request. If n <= 0, all the rules are sent in one request. BatchSize has no
+// effect on a fetch query.
+func (q Query) BatchSize(n int) Query { q.batch = n; return q }
+
 // Invoke executes the query on the given context and client.
+//
+// For an update query sent in several requests, the reply combines the rules,
+// errors, and summary statistics of all the requests. If a request fails,
+// Invoke reports the error along with the combined reply for the requests
+// that preceded it.
 func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
-	// Report a deferred error from encoding.
-	if q.encodeErr != nil {
-		return nil, &jhttp.Error{Message: "encoding rule set", Err: q.encodeErr}
+	if q.set != nil {
+		return q.invokeBatches(ctx, cli)
 	}
-	rsp, err := cli.Call(ctx, q.request)
+	return invoke(ctx, cli, q.request)
+}
+
+func invoke(ctx context.Context, cli *twitter.Client, req *jhttp.Request) (*Reply, error) {
+	rsp, err := cli.Call(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	out := new(Reply)
+	out := &Reply{Reply: rsp}
 	if len(rsp.Data) == 0 {
 		// no rules returned
 	} else if err := json.Unmarshal(rsp.Data, &out.Rules); err != nil {
@@ -133,24 +197,46 @@ type Reply struct {
 	*twitter.Reply
 	Rules []Rule
 	Meta  *Meta
+
+	// For update queries, the rules the service rejected.
+	Failed []Failure
+}
+
+// A Failure describes a rule the service rejected in an update query.
+type Failure struct {
+	// The rule that was rejected. For an addition, this gives the value and
+	// tag of the rule; for a deletion, its ID.
+	Rule Rule
+
+	// The errors reported by the service for the rule.
+	Errors []*types.ErrorDetail
 }
 
 // Meta records rule set metadata reported by the service.
 type Meta struct {
 	Sent    time.Time `json:"sent"`
-	Summary struct {
-		Created    int `json:"created,omitempty"`
-		NotCreated int `json:"not_created,omitempty"`
-		Deleted    int `json:"deleted,omitempty"`
-		NotDeleted int `json:"not_deleted,omitempty"`
-		Valid      int `json:"valid,omitempty"`
-		Invalid    int `json:"invalid,omitempty"`
-	} `json:"summary,omitempty"`
+	Summary Summary   `json:"summary,omitempty"`
+}
+
+// Summary records summary statistics for a rule update.
+type Summary struct {
+	Created    int `json:"created,omitempty"`
+	NotCreated int `json:"not_created,omitempty"`
+	Deleted    int `json:"deleted,omitempty"`
+	NotDeleted int `json:"not_deleted,omitempty"`
+	Valid      int `json:"valid,omitempty"`
+	Invalid    int `json:"invalid,omitempty"`
 }
 
 // A Set encodes a set of rule additions or deletions.
 type Set interface {
 	encode() ([]byte, error)
+
+	size() int                                // the number of rules in the set
+	slice(i, j int) Set                       // the subset of rules in [i, j)
+	omit(drop map[int]bool) Set               // the subset of rules not in drop
+	rule(i int) Rule                          // the ith rule
+	matches(i int, e *types.ErrorDetail) bool // whether e refers to the ith rule
 }
 
 // Add gives a query and optional tag to define a rule.
@@ -162,6 +248,38 @@ type Add struct {
 // Adds is a Set of search rules to be added.
 type Adds []Add
 
+// Check validates the queries of as locally for the given access tier, without
+// issuing a request. It returns nil if all the rules are valid. Otherwise, it
+// returns a slice parallel to as, giving the error for each invalid rule and
+// nil for each valid one. See query.ValidateString for the checks applied.
+func (as Adds) Check(tier query.Tier) []error {
+	var errs []error
+	for i, a := range as {
+		if err := query.ValidateString(a.Query, tier); err != nil {
+			if errs == nil {
+				errs = make([]error, len(as))
+			}
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+func (as Adds) size() int                                { return len(as) }
+func (as Adds) slice(i, j int) Set                       { return as[i:j] }
+func (as Adds) rule(i int) Rule                          { return Rule{Value: as[i].Query, Tag: as[i].Tag} }
+func (as Adds) matches(i int, e *types.ErrorDetail) bool { return e.Value == as[i].Query }
+
+func (as Adds) omit(drop map[int]bool) Set {
+	var out Adds
+	for i, a := range as {
+		if !drop[i] {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
 func (as Adds) encode() ([]byte, error) {
 	rules := make([]Rule, len(as))
 	for i, a := range as {
@@ -175,6 +293,21 @@ func (as Adds) encode() ([]byte, error) {
 // Deletes is a Set of search rule IDs to be deleted.
 type Deletes []string
 
+func (ds Deletes) size() int                                { return len(ds) }
+func (ds Deletes) slice(i, j int) Set                       { return ds[i:j] }
+func (ds Deletes) rule(i int) Rule                          { return Rule{ID: ds[i]} }
+func (ds Deletes) matches(i int, e *types.ErrorDetail) bool { return e.Value == ds[i] }
+
+func (ds Deletes) omit(drop map[int]bool) Set {
+	var out Deletes
+	for i, d := range ds {
+		if !drop[i] {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
 func (ds Deletes) encode() ([]byte, error) {
 	type del struct {
 		I []string `json:"ids"`
@@ -0,0 +1,170 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/types"
+)
+
+// Sync constructs a query to make the active streaming search rules match the
+// desired set, deleting and adding only the rules that differ.
+//
+// An active rule matches a desired rule if their tags are equal and their
+// queries are equal after query.Normalize. Active rules that match no desired
+// rule, and duplicates among the active rules, are deleted. Desired rules that
+// match no active rule are added.
+//
+// The query fetches the active rules, then validates the deletions and
+// additions and, if they are valid, applies the deletions followed by the
+// additions.
+func Sync(desired Adds) SyncQuery { return SyncQuery{desired: desired} }
+
+// A SyncQuery performs a rule reconciliation.
+type SyncQuery struct {
+	desired Adds
+	dryRun  bool
+}
+
+// DryRun returns a copy of q that computes and validates the changes, but
+// does not apply them.
+func (q SyncQuery) DryRun() SyncQuery { q.dryRun = true; return q }
+
+// A SyncReport describes the result of a SyncQuery.
+type SyncReport struct {
+	Kept    []Rule  // active rules that match a desired rule
+	Deletes Deletes // IDs of active rules to delete
+	Adds    Adds    // desired rules to add
+	Applied bool    // whether the changes were applied
+
+	// The rules deleted and created by the update. These are empty if the
+	// changes were not applied.
+	Deleted []Rule
+	Created []Rule
+}
+
+// Invoke executes the query on the given context and client. If the changes
+// are not valid, Invoke reports an error and does not apply them; the report
+// is returned along with the error. Errors from Invoke have concrete type
+// *jhttp.Error.
+func (q SyncQuery) Invoke(ctx context.Context, cli *twitter.Client) (*SyncReport, error) {
+	cur, err := Get().Invoke(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	rep, byID := q.plan(cur.Rules)
+	if len(rep.Deletes) == 0 && len(rep.Adds) == 0 {
+		return rep, nil
+	}
+
+	// Validate all the changes before applying any of them.
+	if len(rep.Deletes) != 0 {
+		if err := checkUpdate(ctx, cli, Validate(rep.Deletes), "validating rule deletions", nil); err != nil {
+			return rep, err
+		}
+	}
+	if len(rep.Adds) != 0 {
+		// The additions are checked against the current rules, so ignore
+		// errors that the deletions will resolve.
+		deleted := make(map[string]bool)
+		for _, id := range rep.Deletes {
+			deleted[byID[id].Value] = true
+		}
+		ignore := func(e *types.ErrorDetail) bool {
+			return (e.Title == "DuplicateRule" && deleted[e.Value]) ||
+				(e.Title == "RulesCapExceeded" && len(deleted) != 0)
+		}
+		if err := checkUpdate(ctx, cli, Validate(rep.Adds), "validating rule additions", ignore); err != nil {
+			return rep, err
+		}
+	}
+	if q.dryRun {
+		return rep, nil
+	}
+
+	rep.Applied = true
+	if len(rep.Deletes) != 0 {
+		if err := checkUpdate(ctx, cli, Update(rep.Deletes), "deleting rules", nil); err != nil {
+			return rep, err
+		}
+		for _, id := range rep.Deletes {
+			rep.Deleted = append(rep.Deleted, byID[id])
+		}
+	}
+	if len(rep.Adds) != 0 {
+		rsp, err := Update(rep.Adds).Invoke(ctx, cli)
+		if err != nil {
+			return rep, err
+		}
+		rep.Created = rsp.Rules
+		if err := replyError(rsp, "adding rules", nil); err != nil {
+			return rep, err
+		}
+	}
+	return rep, nil
+}
+
+// plan computes the changes needed to make the active rules match the desired
+// rules. It also returns the active rules indexed by ID.
+func (q SyncQuery) plan(active []Rule) (*SyncReport, map[string]Rule) {
+	want := make(map[string]bool)
+	for _, a := range q.desired {
+		want[ruleKey(a.Query, a.Tag)] = true
+	}
+	rep := new(SyncReport)
+	byID := make(map[string]Rule)
+	have := make(map[string]bool)
+	for _, r := range active {
+		byID[r.ID] = r
+		key := ruleKey(r.Value, r.Tag)
+		if want[key] && !have[key] {
+			rep.Kept = append(rep.Kept, r)
+		} else {
+			rep.Deletes = append(rep.Deletes, r.ID)
+		}
+		have[key] = true
+	}
+	for _, a := range q.desired {
+		key := ruleKey(a.Query, a.Tag)
+		if !have[key] {
+			rep.Adds = append(rep.Adds, a)
+			have[key] = true
+		}
+	}
+	return rep, byID
+}
+
+// ruleKey returns a comparison key for a rule with the given query and tag.
+func ruleKey(value, tag string) string {
+	if q, err := query.Parse(value); err == nil {
+		value = query.Normalize(q).String()
+	}
+	return fmt.Sprintf("%q %q", tag, value)
+}
+
+// checkUpdate invokes q and reports an error if the service rejected any of
+// the rules, other than those for which ignore returns true.
+func checkUpdate(ctx context.Context, cli *twitter.Client, q Query, msg string, ignore func(*types.ErrorDetail) bool) error {
+	rsp, err := q.Invoke(ctx, cli)
+	if err != nil {
+		return err
+	}
+	return replyError(rsp, msg, ignore)
+}
+
+func replyError(rsp *Reply, msg string, ignore func(*types.ErrorDetail) bool) error {
+	if rsp.Reply == nil {
+		return nil
+	}
+	for _, e := range rsp.Errors {
+		if ignore == nil || !ignore(e) {
+			return &jhttp.Error{Message: msg, Err: twitter.DetailError(e)}
+		}
+	}
+	return nil
+}
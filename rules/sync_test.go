@@ -0,0 +1,85 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package rules_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/nankys/twitter/rules"
+	"github.com/nankys/twitter/twittertest"
+)
+
+func TestSync(t *testing.T) {
+	srv := twittertest.NewServer(nil)
+	defer srv.Close()
+	cli := srv.Client()
+	ctx := context.Background()
+
+	rsp, err := rules.Update(rules.Adds{
+		{Query: "cat OR kitten", Tag: "cats"},
+		{Query: "from:bob", Tag: "bob"},
+		{Query: "dog", Tag: "dogs"},
+	}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	catID := rsp.Rules[0].ID
+
+	desired := rules.Adds{
+		{Query: "Kitten OR cat", Tag: "cats"}, // same rule, written differently
+		{Query: "from:bob", Tag: "robert"},    // same query, new tag
+		{Query: "bird", Tag: "birds"},
+	}
+
+	// A dry run reports the changes without applying them.
+	rep, err := rules.Sync(desired).DryRun().Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Sync dry run failed: %v", err)
+	}
+	if rep.Applied || len(rep.Kept) != 1 || len(rep.Deletes) != 2 || len(rep.Adds) != 2 {
+		t.Errorf("Sync dry run: got %+v, want 1 kept, 2 deletes, 2 adds", rep)
+	}
+	if got := srv.Rules(); len(got) != 3 {
+		t.Errorf("Rules after dry run: got %+v, want 3", got)
+	}
+
+	rep, err = rules.Sync(desired).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !rep.Applied || len(rep.Deleted) != 2 || len(rep.Created) != 2 {
+		t.Errorf("Sync: got %+v, want 2 deleted, 2 created", rep)
+	}
+	if len(rep.Kept) != 1 || rep.Kept[0].ID != catID {
+		t.Errorf("Sync kept %+v, want rule %s", rep.Kept, catID)
+	}
+	var tags []string
+	for _, r := range srv.Rules() {
+		tags = append(tags, r.Tag)
+	}
+	sort.Strings(tags)
+	if len(tags) != 3 || tags[0] != "birds" || tags[1] != "cats" || tags[2] != "robert" {
+		t.Errorf("Rules after sync: got tags %q, want birds, cats, robert", tags)
+	}
+
+	// Syncing again makes no changes.
+	rep, err = rules.Sync(desired).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	} else if rep.Applied || len(rep.Kept) != 3 {
+		t.Errorf("Sync again: got %+v, want 3 kept and no changes", rep)
+	}
+
+	// An invalid rule prevents any change.
+	rep, err = rules.Sync(rules.Adds{{Query: "(bird", Tag: "birds"}}).Invoke(ctx, cli)
+	if err == nil {
+		t.Errorf("Sync with invalid rule: got %+v, want error", rep)
+	} else if rep.Applied {
+		t.Errorf("Sync with invalid rule: changes applied: %+v", rep)
+	}
+	if got := srv.Rules(); len(got) != 3 {
+		t.Errorf("Rules after failed sync: got %+v, want 3", got)
+	}
+}
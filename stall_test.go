@@ -0,0 +1,117 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+)
+
+// stallingServer returns a server that streams each of the given messages in
+// turn, pausing for the given delay before each, and then stops sending data
+// without closing the stream.
+func stallingServer(t *testing.T, delay time.Duration, msgs ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for _, msg := range msgs {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(delay):
+			}
+			w.Write([]byte(msg))
+			w.(http.Flusher).Flush()
+		}
+		<-req.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStall(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req := &jhttp.Request{Method: "2/tweets/search/stream"}
+
+	t.Run("KeepAlive", func(t *testing.T) {
+		// Keep-alives arrive more often than the timeout, then stop.
+		srv := stallingServer(t, 20*time.Millisecond,
+			`{"data":{"id":"1"}}`+"\r\n", "\r\n", "\r\n", "\r\n", `{"data":{"id":"2"}}`+"\r\n")
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.StallTimeout = 100 * time.Millisecond
+
+		var m twitter.StreamMonitor
+		var nr int
+		err := cli.StreamMonitored(ctx, req, &m, func(*twitter.Reply) error {
+			nr++
+			if h := m.Health(); !h.Open {
+				t.Error("Health: stream is not open during a callback")
+			}
+			return nil
+		})
+		if !errors.Is(err, twitter.ErrStreamStalled) {
+			t.Errorf("Stream: got error %v, want %v", err, twitter.ErrStreamStalled)
+		}
+		if nr != 2 {
+			t.Errorf("Stream: got %d messages, want 2", nr)
+		}
+		h := m.Health()
+		if h.Open || h.Messages != 2 || h.Stalls != 1 {
+			t.Errorf("Health: got %+v, want closed with 2 messages and 1 stall", h)
+		}
+		if want := int64(2*len(`{"data":{"id":"1"}}`+"\r\n") + 3*len("\r\n")); h.Bytes != want {
+			t.Errorf("Health: got %d bytes, want %d", h.Bytes, want)
+		}
+		if h.Idle() != 0 {
+			t.Errorf("Health: idle %v for a closed stream, want 0", h.Idle())
+		}
+	})
+
+	t.Run("SlowCallback", func(t *testing.T) {
+		// Time spent in the callback does not count as a stall.
+		srv := stallingServer(t, 0, `{"data":{"id":"1"}}`+"\r\n", `{"data":{"id":"2"}}`+"\r\n")
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+		cli.StallTimeout = 50 * time.Millisecond
+
+		var nr int
+		err := cli.Stream(ctx, req, func(*twitter.Reply) error {
+			nr++
+			time.Sleep(100 * time.Millisecond)
+			if nr == 2 {
+				return jhttp.ErrStopStreaming
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Stream: unexpected error: %v", err)
+		}
+	})
+
+	t.Run("NoTimeout", func(t *testing.T) {
+		srv := stallingServer(t, 0)
+		cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+		var m twitter.StreamMonitor
+		sctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- cli.StreamMonitored(sctx, req, &m, func(*twitter.Reply) error { return nil }) }()
+
+		time.Sleep(50 * time.Millisecond)
+		if h := m.Health(); !h.Open || h.Idle() < 25*time.Millisecond {
+			t.Errorf("Health: got %+v, idle %v; want open and idle", h, h.Idle())
+		}
+		cancel()
+		if err := <-done; errors.Is(err, twitter.ErrStreamStalled) {
+			t.Errorf("Stream: got error %v, want cancellation", err)
+		}
+	})
+}
@@ -0,0 +1,236 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/creachadair/jhttp"
+)
+
+// ErrStreamStalled is reported when a stream receives no data from the server
+// within the StallTimeout of the client.
+var ErrStreamStalled = errors.New("stream stalled")
+
+// A StreamMonitor records the health of a stream as it runs. A zero
+// StreamMonitor is ready for use, and is safe for concurrent use. The same
+// monitor may be used for successive connections of a stream.
+type StreamMonitor struct {
+	mu sync.Mutex
+	h  StreamHealth
+}
+
+// A StreamHealth is a snapshot of the health of a stream.
+type StreamHealth struct {
+	Open      bool      // whether a connection is open
+	Connected time.Time // when the most recent connection was established
+	LastRead  time.Time // when data, including a keep-alive, was last received
+	Bytes     int64     // the total number of bytes received
+	Messages  int64     // the total number of messages received
+	Stalls    int       // the number of connections closed as stalled
+}
+
+// Idle reports how long the stream has been waiting for data, or 0 if no
+// connection is open.
+func (h StreamHealth) Idle() time.Duration {
+	if !h.Open {
+		return 0
+	} else if h.LastRead.After(h.Connected) {
+		return time.Since(h.LastRead)
+	}
+	return time.Since(h.Connected)
+}
+
+// Health returns a snapshot of the current health of the stream.
+func (m *StreamMonitor) Health() StreamHealth {
+	if m == nil {
+		return StreamHealth{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.h
+}
+
+func (m *StreamMonitor) update(f func(h *StreamHealth)) {
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		f(&m.h)
+	}
+}
+
+// stream issues ex.Request and delivers the replies from the resulting stream
+// to ex.Callback. It records the response headers in ex.Header as soon as they
+// are received.
+//
+// This duplicates the streaming logic of the underlying jhttp.Client, which
+// does not expose the response headers for a stream.
+func (c *Client) stream(ctx context.Context, ex *Exchange) error {
+	key := Endpoint(ex.Request)
+	if c.Credentials != nil {
+		return c.Credentials.call(ctx, key, func(auth jhttp.Authorizer) (http.Header, error) {
+			ex.Header = nil
+			err := c.streamWith(ctx, ex, auth, nil)
+			return ex.Header, err
+		})
+	}
+	if err := c.Limiter.acquire(ctx, key); err != nil {
+		return err
+	}
+	return c.streamWith(ctx, ex, c.Authorize, func(h http.Header) {
+		c.Limiter.update(key, decodeRateLimits(h))
+	})
+}
+
+// streamWith issues ex.Request with the given authorizer and delivers the
+// replies from the resulting stream to ex.Callback. If onHeader != nil, it is
+// called with the response headers once they are received.
+func (c *Client) streamWith(ctx context.Context, ex *Exchange, auth jhttp.Authorizer, onHeader func(http.Header)) error {
+	rsp, err := c.start(ctx, ex.Request, auth)
+	if err != nil {
+		return err
+	}
+	body := rsp.Body
+	defer body.Close()
+
+	ex.Header = rsp.Header
+	if onHeader != nil {
+		onHeader(rsp.Header)
+	}
+	c.log(jhttp.LogHTTPStatus, rsp.Status)
+	if rsp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(body)
+		c.log(jhttp.LogResponseBody, string(data))
+		return withAPIError(&jhttp.Error{
+			Status:  rsp.StatusCode,
+			Data:    data,
+			Message: "request failed: " + rsp.Status,
+		})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// When ctx ends, close the response body to unblock the reader.
+	go func() {
+		<-ctx.Done()
+		body.Close()
+	}()
+
+	m := ex.Monitor
+	m.update(func(h *StreamHealth) { h.Open = true; h.Connected = time.Now() })
+	defer m.update(func(h *StreamHealth) { h.Open = false })
+
+	sr := &stallReader{r: body, m: m, timeout: c.StallTimeout}
+	if sr.timeout > 0 {
+		sr.timer = time.AfterFunc(sr.timeout, func() {
+			atomic.StoreInt32(&sr.stalled, 1)
+			cancel()
+		})
+		sr.timer.Stop()
+		defer sr.timer.Stop()
+	}
+
+	dec := json.NewDecoder(sr)
+	for {
+		var next json.RawMessage
+		if err := dec.Decode(&next); atomic.LoadInt32(&sr.stalled) != 0 {
+			m.update(func(h *StreamHealth) { h.Stalls++ })
+			return &jhttp.Error{Message: "reading stream", Err: ErrStreamStalled}
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return &jhttp.Error{Message: "decoding message from stream", Err: err}
+		}
+		c.log(jhttp.LogStreamBody, string(next))
+		ex.Bytes += int64(len(next))
+		m.update(func(h *StreamHealth) { h.Messages++ })
+
+		var reply Reply
+		if err := json.Unmarshal(next, &reply); err != nil {
+			return &jhttp.Error{Data: next, Message: "decoding stream response", Err: err}
+		}
+		if err := ex.Callback(&reply); errors.Is(err, jhttp.ErrStopStreaming) {
+			return nil // the callback requested a stop
+		} else if err != nil {
+			return &jhttp.Error{Message: "callback", Err: err}
+		}
+	}
+}
+
+// A stallReader records reads from a stream in a monitor, and if it has a
+// timer, arms the timer while it waits for data.
+type stallReader struct {
+	r       io.Reader
+	m       *StreamMonitor
+	timer   *time.Timer // if non-nil, marks the stream stalled and closes it
+	timeout time.Duration
+	stalled int32 // set to 1 when the timer fires
+}
+
+func (s *stallReader) Read(data []byte) (int, error) {
+	// Only time spent waiting for the server counts toward a stall, not time
+	// spent by the caller processing messages.
+	if s.timer != nil {
+		s.timer.Reset(s.timeout)
+	}
+	nr, err := s.r.Read(data)
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if nr > 0 {
+		s.m.update(func(h *StreamHealth) { h.LastRead = time.Now(); h.Bytes += int64(nr) })
+	}
+	return nr, err
+}
+
+// start issues req with the given authorizer and returns its HTTP response.
+// The caller is responsible for closing the response body.
+func (c *Client) start(ctx context.Context, req *jhttp.Request, auth jhttp.Authorizer) (*http.Response, error) {
+	requestURL, err := req.URL(c.BaseURL)
+	if err != nil {
+		return nil, &jhttp.Error{Message: "invalid request URL", Err: err}
+	}
+	c.log(jhttp.LogRequestURL, requestURL)
+
+	data, dlen, dtype := req.Body()
+	hreq, err := http.NewRequestWithContext(ctx, req.HTTPMethod, requestURL, data)
+	if err != nil {
+		return nil, &jhttp.Error{Message: "invalid request", Err: err}
+	}
+	hreq.ContentLength = dlen
+	if dlen > 0 {
+		hreq.Header.Set("Content-Type", dtype)
+	}
+	if auth != nil {
+		if err := auth(hreq); err != nil {
+			return nil, &jhttp.Error{Message: "attaching authorization", Err: err}
+		}
+		c.log(jhttp.LogAuthorization, hreq.Header.Get("authorization"))
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	rsp, err := hc.Do(hreq)
+	if err != nil {
+		return nil, &jhttp.Error{Message: "issuing request", Err: err}
+	}
+	return rsp, nil
+}
+
+// log sends message to the log function of the underlying client, if it has
+// one and its mask admits tag.
+func (c *Client) log(tag jhttp.LogTag, message string) {
+	if c.Log != nil && (c.LogMask == 0 || c.LogMask&tag != 0) {
+		c.Log(tag, message)
+	}
+}
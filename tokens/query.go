@@ -19,7 +19,10 @@ import (
 
 func clientWithAuth(cli *twitter.Client, auth jhttp.Authorizer) *twitter.Client {
 	cp := *cli // shallow copy
-	cp.Authorize = auth
+	hc := *cli.Client
+	hc.Authorize = auth
+	cp.Client = &hc
+	cp.Credentials = nil // use auth, not a credential from the pool
 	return &cp
 }
 
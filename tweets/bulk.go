@@ -0,0 +1,74 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package tweets
+
+import (
+	"context"
+
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/internal/bulk"
+)
+
+// BulkLookup constructs a query to look up any number of tweet IDs. When the
+// query is invoked, the IDs are split into batches of at most 100, which are
+// looked up concurrently and merged into a single reply. Duplicate IDs are
+// looked up only once.
+//
+// Each batch is an ordinary request, subject to the limiter and retry policy
+// of the client. To stay within rate limits for large lookups, set a Limiter
+// on the client that waits for the limit to reset.
+//
+// API: 2/tweets
+func BulkLookup(ids []string, opts *BulkOpts) BulkQuery {
+	return BulkQuery{ids: ids, opts: opts}
+}
+
+// BulkOpts provides parameters for bulk tweet lookup. A nil *BulkOpts provides
+// empty values for all fields.
+type BulkOpts = bulk.Opts
+
+// A BulkQuery performs a lookup query for any number of tweet IDs.
+type BulkQuery struct {
+	ids  []string
+	opts *BulkOpts
+}
+
+// Invoke executes the query on the given context and client. The Tweets of the
+// reply contain the tweets from all batches, in batch order, and its Results
+// map has an entry for every requested ID. The includes and error details of
+// all batches are merged into the reply.
+//
+// If any batch fails, Invoke stops issuing new batches and reports the error
+// from that batch, along with a reply that combines the batches that
+// succeeded. IDs that were not looked up have no entry in the Results map of
+// the reply.
+func (q BulkQuery) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
+	batches := bulk.Split(q.ids, bulk.MaxBatchSize, nil)
+	rsps := make([]*Reply, len(batches))
+	err := bulk.Run(ctx, batches, bulk.Concurrency(q.opts), func(ctx context.Context, i int, batch []string) error {
+		rsp, err := Lookup(batch[0], &LookupOpts{
+			More:     batch[1:],
+			Optional: bulk.Optional(q.opts),
+		}).Invoke(ctx, cli)
+		if err == nil {
+			rsps[i] = rsp
+		}
+		return err
+	})
+
+	out := &Reply{Reply: new(twitter.Reply), Results: make(map[string]*LookupResult)}
+	for _, rsp := range rsps {
+		if rsp == nil {
+			continue // failed or not issued
+		}
+		if err := out.Reply.Merge(rsp.Reply); err != nil {
+			return nil, err
+		}
+		out.RateLimit = rsp.RateLimit
+		out.Tweets = append(out.Tweets, rsp.Tweets...)
+		for id, r := range rsp.Results {
+			out.Results[id] = r
+		}
+	}
+	return out, err
+}
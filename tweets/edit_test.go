@@ -0,0 +1,35 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package tweets_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/tweets"
+)
+
+func TestCreate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte(`{"data":{"id":"100","text":"hello"}}`))
+	}))
+	defer srv.Close()
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+	// Regression: Invoke must not panic for a query without parameters.
+	rsp, err := tweets.Create(tweets.CreateOpts{Text: "hello"}).Invoke(context.Background(), cli)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if len(rsp.Tweets) != 1 || rsp.Tweets[0].ID != "100" {
+		t.Errorf("Create: got %+v, want tweet 100", rsp.Tweets)
+	}
+}
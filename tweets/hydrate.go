@@ -0,0 +1,205 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package tweets
+
+import (
+	"github.com/nankys/twitter/types"
+)
+
+// A Hydrated is a tweet linked to the objects it refers to, as resolved from
+// the includes of a reply. See (*Reply).Hydrate.
+type Hydrated struct {
+	*types.Tweet
+
+	Author    *types.User    // the author of the tweet (author_id)
+	InReplyTo *types.User    // the user replied to (in_reply_to_user_id)
+	Media     []*types.Media // attached media (attachments.media_keys)
+	Polls     []*types.Poll  // attached polls (attachments.poll_ids)
+	Place     *types.Place   // the tagged place (geo.place_id)
+
+	// The tweets referenced by this tweet, in the order they are listed in
+	// the Referenced field of the tweet.
+	Referenced []*HydratedRef
+
+	// References from this tweet that could not be resolved from the reply.
+	// This does not include references from the tweets it links to.
+	Missing []*Missing
+}
+
+// A HydratedRef is a reference from a hydrated tweet to another tweet.
+type HydratedRef struct {
+	Type  string    // e.g., "quoted", "replied_to", "retweeted"
+	ID    string    // the ID of the referenced tweet
+	Tweet *Hydrated // the referenced tweet, or nil if it is missing
+}
+
+// Ref returns the first referenced tweet of the given type, for example
+// "quoted", or nil if there is none or it is missing.
+func (h *Hydrated) Ref(refType string) *Hydrated {
+	for _, ref := range h.Referenced {
+		if ref.Type == refType {
+			return ref.Tweet
+		}
+	}
+	return nil
+}
+
+// Missing reports a reference that could not be resolved from a reply.
+type Missing struct {
+	// The field containing the reference, named as in the API's expansions,
+	// e.g., "author_id" or "attachments.media_keys".
+	Field string
+
+	// The ID or media key of the missing object.
+	ID string
+
+	// The error reported by the server for the missing object, or nil if the
+	// server did not report one. If the object was not reported and there is
+	// no error, most likely the corresponding expansion was not requested.
+	Error *types.ErrorDetail
+}
+
+// Hydrate returns the tweets of r, each linked to the users, media, polls,
+// places and tweets it refers to, as resolved from the includes of r.
+//
+// Referenced tweets are hydrated in turn, whether they appear among the
+// tweets of r or in its includes, so that for example the author of a quoted
+// tweet is available as h.Ref("quoted").Author. References that cannot be
+// resolved are listed in the Missing field of each hydrated tweet.
+func (r *Reply) Hydrate() ([]*Hydrated, error) {
+	users, err := r.IncludedUsers()
+	if err != nil {
+		return nil, err
+	}
+	media, err := r.IncludedMedia()
+	if err != nil {
+		return nil, err
+	}
+	polls, err := r.IncludedPolls()
+	if err != nil {
+		return nil, err
+	}
+	places, err := r.IncludedPlaces()
+	if err != nil {
+		return nil, err
+	}
+	tweets, err := r.IncludedTweets()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &hydrator{
+		users:  make(map[string]*types.User),
+		media:  make(map[string]*types.Media),
+		polls:  make(map[string]*types.Poll),
+		places: make(map[string]*types.Place),
+		tweets: make(map[string]*types.Tweet),
+		errs:   make(map[string][]*types.ErrorDetail),
+		done:   make(map[string]*Hydrated),
+	}
+	for _, u := range users {
+		h.users[u.ID] = u
+	}
+	for _, m := range media {
+		h.media[m.Key] = m
+	}
+	for _, p := range polls {
+		h.polls[p.ID] = p
+	}
+	for _, p := range places {
+		h.places[p.ID] = p
+	}
+	for _, t := range tweets {
+		h.tweets[t.ID] = t
+	}
+	for _, t := range r.Tweets {
+		h.tweets[t.ID] = t
+	}
+	for _, e := range r.Errors {
+		h.errs[e.Value] = append(h.errs[e.Value], e)
+	}
+
+	out := make([]*Hydrated, len(r.Tweets))
+	for i, t := range r.Tweets {
+		out[i] = h.hydrate(t)
+	}
+	return out, nil
+}
+
+type hydrator struct {
+	users  map[string]*types.User
+	media  map[string]*types.Media
+	polls  map[string]*types.Poll
+	places map[string]*types.Place
+	tweets map[string]*types.Tweet
+	errs   map[string][]*types.ErrorDetail // by object ID
+	done   map[string]*Hydrated            // tweets already hydrated, by ID
+}
+
+// errorFor returns the error reported for the object with the given ID in the
+// given field, or nil if there is none. If no error names the field, any
+// error for the ID is accepted.
+func (h *hydrator) errorFor(field, id string) *types.ErrorDetail {
+	errs := h.errs[id]
+	for _, e := range errs {
+		if e.Parameter == field {
+			return e
+		}
+	}
+	if len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (h *hydrator) hydrate(t *types.Tweet) *Hydrated {
+	if out, ok := h.done[t.ID]; ok {
+		return out
+	}
+	out := &Hydrated{Tweet: t}
+	h.done[t.ID] = out // before recurring, in case of cycles
+
+	miss := func(field, id string) {
+		out.Missing = append(out.Missing, &Missing{Field: field, ID: id, Error: h.errorFor(field, id)})
+	}
+	if id := t.AuthorID; id != "" {
+		if out.Author = h.users[id]; out.Author == nil {
+			miss("author_id", id)
+		}
+	}
+	if id := t.InReplyTo; id != "" {
+		if out.InReplyTo = h.users[id]; out.InReplyTo == nil {
+			miss("in_reply_to_user_id", id)
+		}
+	}
+	for _, key := range t.Attachments["media_keys"] {
+		if m := h.media[key]; m != nil {
+			out.Media = append(out.Media, m)
+		} else {
+			miss("attachments.media_keys", key)
+		}
+	}
+	for _, id := range t.Attachments["poll_ids"] {
+		if p := h.polls[id]; p != nil {
+			out.Polls = append(out.Polls, p)
+		} else {
+			miss("attachments.poll_ids", id)
+		}
+	}
+	if t.Location != nil && t.Location.PlaceID != "" {
+		id := t.Location.PlaceID
+		if out.Place = h.places[id]; out.Place == nil {
+			miss("geo.place_id", id)
+		}
+	}
+	for _, ref := range t.Referenced {
+		hr := &HydratedRef{Type: ref.Type, ID: ref.ID}
+		if rt := h.tweets[ref.ID]; rt != nil {
+			hr.Tweet = h.hydrate(rt)
+		} else {
+			miss("referenced_tweets.id", ref.ID)
+		}
+		out.Referenced = append(out.Referenced, hr)
+	}
+	return out
+}
@@ -24,7 +24,10 @@ func SearchRecent(query string, opts *SearchOpts) Query {
 	}
 	req.Params.Set("query", query)
 	opts.addRequestParams(req)
-	return Query{Request: req}
+
+	// N.B. For some reason the "search recent" API uses a different pagination
+	// token parameter than the rest of the API.
+	return Query{Request: req, tokenParam: "next_token"}
 }
 
 // SearchOpts provides parameters for tweet search. A nil *SearchOpts provides
@@ -5,6 +5,12 @@ package tweets
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/creachadair/jhttp"
 	"github.com/nankys/twitter"
@@ -20,7 +26,7 @@ func SampleStream(f Callback, opts *StreamOpts) Stream {
 		Params: make(jhttp.Params),
 	}
 	opts.addRequestParams(req)
-	return Stream{Request: req, callback: f, maxResults: opts.maxResults()}
+	return newStream(req, f, opts)
 }
 
 // SearchStream constructs a streaming search query that delivers results to f.
@@ -32,7 +38,17 @@ func SearchStream(f Callback, opts *StreamOpts) Stream {
 		Params: make(jhttp.Params),
 	}
 	opts.addRequestParams(req)
-	return Stream{Request: req, callback: f, maxResults: opts.maxResults()}
+	return newStream(req, f, opts)
+}
+
+func newStream(req *jhttp.Request, f Callback, opts *StreamOpts) Stream {
+	s := Stream{Request: req, callback: f}
+	if opts != nil {
+		s.maxResults = opts.MaxResults
+		s.reconnect = opts.Reconnect
+		s.monitor = opts.Monitor
+	}
+	return s
 }
 
 // A Stream performs a streaming search or sampling query.
@@ -40,16 +56,28 @@ type Stream struct {
 	*jhttp.Request
 	callback   Callback
 	maxResults int
+	reconnect  *ReconnectPolicy
+	monitor    *twitter.StreamMonitor
 }
 
 // StreamOpts provides parameters for tweet streaming. A nil *StreamOpts
 // provides empty values for all fields.
 type StreamOpts struct {
 	// If positive, stop streaming after this many results have been reported.
+	// The count includes results from all connections, if the stream
+	// reconnects.
 	MaxResults int
 
 	// Optional response fields and expansions.
 	Optional []types.Fields
+
+	// If non-nil, reconnect automatically when the stream ends or fails with
+	// an error that may succeed on retry, as described by the policy.
+	Reconnect *ReconnectPolicy
+
+	// If non-nil, record the health of the stream in this monitor. Use the
+	// StallTimeout of the client to close a stream that stops receiving data.
+	Monitor *twitter.StreamMonitor
 }
 
 func (o *StreamOpts) addRequestParams(req *jhttp.Request) {
@@ -63,35 +91,248 @@ func (o *StreamOpts) addRequestParams(req *jhttp.Request) {
 	}
 }
 
-func (o *StreamOpts) maxResults() int {
-	if o == nil {
-		return 0
-	}
-	return o.MaxResults
-}
-
 // A Callback receives streaming replies from a sample or streaming search
-// query. If the callback returns an error, the stream is terminated. If the
-// error is not jhttp.ErrStopStreaming, that error is reported to the caller.
+// query. Each reply carries either a single tweet, or the system events
+// reported by a message that has no tweet. A reply may therefore carry only
+// Events, with an empty Tweets slice, and a callback must check for this.
+//
+// If the callback returns an error, the stream is terminated. If the error is
+// not jhttp.ErrStopStreaming, that error is reported to the caller.
 type Callback func(*Reply) error
 
 // Invoke executes the streaming query on the given context and client.
+//
+// If the server sends an operational disconnect or a connection error and
+// then closes the stream, Invoke reports an error wrapping the *APIError
+// that describes it.
+//
+// If the stream has a reconnect policy, Invoke reconnects when the stream is
+// closed by the server or fails with a network error, an HTTP 5xx status, or
+// an exhausted rate limit, until ctx ends or the policy gives up. Otherwise,
+// Invoke returns when the stream ends.
 func (s Stream) Invoke(ctx context.Context, cli *twitter.Client) error {
-	var nr int
-	return cli.Stream(ctx, s.Request, func(rsp *twitter.Reply) error {
-		nr++
-		var tweet types.Tweet
-		if err := json.Unmarshal(rsp.Data, &tweet); err != nil {
-			return &jhttp.Error{Data: rsp.Data, Message: "decoding tweet data", Err: err}
+	var nr, attempt int
+	for {
+		var cbErr error
+		var closing *StreamEvent // the last notice that the stream will close
+		err := cli.StreamMonitored(ctx, s.Request, s.monitor, func(rsp *twitter.Reply) error {
+			// A message with errors but no data is a system message, which does
+			// not count as a result.
+			if len(rsp.Data) == 0 && len(rsp.Errors) != 0 {
+				evs := make([]*StreamEvent, len(rsp.Errors))
+				for i, e := range rsp.Errors {
+					evs[i] = newStreamEvent(e)
+					if evs[i].Kind != EventError {
+						closing = evs[i]
+					}
+				}
+				if err := s.callback(&Reply{Reply: rsp, Events: evs}); err != nil {
+					cbErr = err
+					return err
+				}
+				return nil
+			}
+
+			// A message with neither data nor errors carries nothing to report,
+			// so skip it rather than failing to decode it as a tweet.
+			if len(rsp.Data) == 0 {
+				return nil
+			}
+
+			nr++
+			attempt = 0 // the connection is healthy
+			var tweet types.Tweet
+			if err := json.Unmarshal(rsp.Data, &tweet); err != nil {
+				cbErr = &jhttp.Error{Data: rsp.Data, Message: "decoding tweet data", Err: err}
+				return cbErr
+			}
+			if err := s.callback(&Reply{
+				Reply:  rsp,
+				Tweets: types.Tweets{&tweet},
+			}); err != nil {
+				cbErr = err
+				return err
+			} else if s.maxResults > 0 && nr == s.maxResults {
+				return jhttp.ErrStopStreaming
+			}
+			return nil
+		})
+		if err == nil && cbErr == nil && closing != nil && ctx.Err() == nil {
+			err = &jhttp.Error{
+				Message: "stream closed by server",
+				Err:     closeError{twitter.DetailError(closing.Detail)},
+			}
 		}
-		if err := s.callback(&Reply{
-			Reply:  rsp,
-			Tweets: types.Tweets{&tweet},
-		}); err != nil {
+		if s.reconnect == nil || cbErr != nil || ctx.Err() != nil ||
+			(err == nil && s.maxResults > 0 && nr >= s.maxResults) {
 			return err
-		} else if s.maxResults > 0 && nr == s.maxResults {
-			return jhttp.ErrStopStreaming
 		}
-		return nil
-	})
+
+		attempt++
+		delay, ok := s.reconnect.delay(attempt, err)
+		if !ok {
+			return err
+		}
+		if s.reconnect.OnReconnect != nil {
+			s.reconnect.OnReconnect(ReconnectEvent{
+				Attempt: attempt,
+				Err:     err,
+				Delay:   delay,
+				Results: nr,
+			})
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// closeError wraps the error reported when the server sends a notice and then
+// closes the stream, to distinguish it from other errors.
+type closeError struct{ err error }
+
+func (c closeError) Error() string { return c.err.Error() }
+func (c closeError) Unwrap() error { return c.err }
+
+// A StreamEvent is a system message delivered by a stream in place of a
+// tweet, such as a notice that the server is about to close the stream.
+type StreamEvent struct {
+	Kind   EventKind
+	Detail *types.ErrorDetail // the message as reported by the server
+}
+
+func newStreamEvent(e *types.ErrorDetail) *StreamEvent {
+	kind := EventError
+	switch {
+	case e.DisconnectType != "", strings.HasSuffix(e.TypeURL, "/operational-disconnect"):
+		kind = EventDisconnect
+	case e.ConnectionIssue != "", e.Title == "ConnectionException":
+		kind = EventConnection
+	}
+	return &StreamEvent{Kind: kind, Detail: e}
+}
+
+// An EventKind classifies a StreamEvent.
+type EventKind int
+
+// Constants for EventKind.
+const (
+	EventError      EventKind = iota + 1 // an error that does not end the stream
+	EventDisconnect                      // an operational disconnect by the server
+	EventConnection                      // a connection problem, e.g., too many connections
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventError:
+		return "Error"
+	case EventDisconnect:
+		return "Disconnect"
+	case EventConnection:
+		return "Connection"
+	}
+	return "EventKind(?)"
+}
+
+// A ReconnectPolicy controls how a stream reconnects after it ends. The delay
+// before each attempt follows the schedule recommended for the API:
+//
+//   - When the server closes the stream, the connection fails or is reset, or
+//     the stream stalls (see twitter.ErrStreamStalled), the delay increases
+//     linearly by NetworkDelay, up to 64 times that delay.
+//   - When the server reports an HTTP 5xx error, the delay starts at HTTPDelay
+//     and doubles with each attempt, up to 64 times that delay.
+//   - When the rate limit is exhausted (HTTP 429), the delay starts at
+//     RateLimitDelay and doubles with each attempt, up to 64 times that delay.
+//
+// Other errors end the stream without reconnecting. These include an HTTP 4xx
+// status, an error from the callback, and local failures that would recur on
+// each attempt, such as an invalid URL, an untrusted certificate, or an error
+// authorizing the request. The attempt count resets whenever the stream
+// delivers a result.
+type ReconnectPolicy struct {
+	// If positive, the maximum number of consecutive attempts to reconnect
+	// before giving up; otherwise there is no limit.
+	MaxAttempts int
+
+	// The initial delays for each kind of failure. If zero, the defaults are
+	// 250 milliseconds, 5 seconds, and 1 minute respectively.
+	NetworkDelay   time.Duration
+	HTTPDelay      time.Duration
+	RateLimitDelay time.Duration
+
+	// If non-nil, OnReconnect is called before waiting to reconnect.
+	OnReconnect func(ReconnectEvent)
+}
+
+// A ReconnectEvent describes an attempt to reconnect a stream.
+type ReconnectEvent struct {
+	Attempt int           // the consecutive attempt number, from 1
+	Err     error         // the error that ended the stream, or nil if it was closed
+	Delay   time.Duration // the delay before reconnecting
+	Results int           // the total number of results delivered so far
+}
+
+// delay returns the delay before the given attempt to reconnect after the
+// stream ended with err, and reports whether to make the attempt at all.
+func (p *ReconnectPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempt > p.MaxAttempts {
+		return 0, false
+	}
+	var jerr *jhttp.Error
+	switch {
+	case errors.Is(err, twitter.ErrRateLimited):
+		return backoff(orDefault(p.RateLimitDelay, time.Minute), attempt), true
+	case errors.As(err, &jerr) && jerr.Status >= 500:
+		return backoff(orDefault(p.HTTPDelay, 5*time.Second), attempt), true
+	case errors.As(err, &jerr) && jerr.Status != 0:
+		return 0, false // other HTTP errors are not transient
+	case !isDisconnect(err):
+		return 0, false
+	}
+	base := orDefault(p.NetworkDelay, 250*time.Millisecond)
+	if attempt > 64 {
+		attempt = 64
+	}
+	return time.Duration(attempt) * base, true
+}
+
+// isDisconnect reports whether err, which is not an HTTP error, means the
+// connection to the server was lost or closed. Other errors, such as a bad URL
+// or a failure to verify the server's certificate, are local and would recur
+// on each attempt to reconnect.
+func isDisconnect(err error) bool {
+	if err == nil || errors.As(err, new(closeError)) {
+		return true // the server closed the stream
+	}
+	var oerr *net.OpError
+	if errors.As(err, &oerr) && (oerr.Op == "dial" || oerr.Op == "read") {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, twitter.ErrStreamStalled)
+}
+
+// backoff returns the exponential delay from base for the given attempt, up
+// to 64 times base.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if attempt > 7 {
+		attempt = 7
+	}
+	return base << (attempt - 1)
+}
+
+func orDefault(d, dflt time.Duration) time.Duration {
+	if d <= 0 {
+		return dflt
+	}
+	return d
 }
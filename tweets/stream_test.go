@@ -0,0 +1,318 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package tweets_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/rules"
+	"github.com/nankys/twitter/tweets"
+	"github.com/nankys/twitter/twittertest"
+	"github.com/nankys/twitter/types"
+)
+
+func TestReconnect(t *testing.T) {
+	srv := twittertest.NewServer(&twittertest.Seed{
+		Users: []*types.User{{ID: "1", Username: "alice"}},
+	})
+	defer srv.Close()
+	cli := srv.Client()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := rules.Update(rules.Adds{{Query: "cat", Tag: "cats"}}).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var events []tweets.ReconnectEvent
+	policy := &tweets.ReconnectPolicy{
+		NetworkDelay:   time.Millisecond,
+		HTTPDelay:      2 * time.Millisecond,
+		RateLimitDelay: 5 * time.Millisecond,
+		OnReconnect: func(e tweets.ReconnectEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		},
+	}
+	takeEvents := func() []tweets.ReconnectEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		out := events
+		events = nil
+		return out
+	}
+
+	t.Run("Schedule", func(t *testing.T) {
+		got := make(chan string, 10)
+		done := make(chan error, 1)
+		srv.RefuseStreams(2, http.StatusServiceUnavailable)
+		go func() {
+			done <- tweets.SearchStream(func(rsp *tweets.Reply) error {
+				got <- rsp.Tweets[0].Text
+				return nil
+			}, &tweets.StreamOpts{MaxResults: 3, Reconnect: policy}).Invoke(ctx, cli)
+		}()
+
+		// The stream connects after two refusals.
+		if err := srv.WaitStreams(ctx, 1); err != nil {
+			t.Fatalf("WaitStreams: %v", err)
+		}
+		srv.Inject(&types.Tweet{Text: "cat 1", AuthorID: "1"})
+		if text := <-got; text != "cat 1" {
+			t.Errorf("Got %q, want cat 1", text)
+		}
+
+		// After a disconnect, the stream reconnects and continues to count
+		// results toward the maximum.
+		srv.RefuseStreams(1, http.StatusTooManyRequests)
+		srv.Disconnect()
+		if err := srv.WaitStreams(ctx, 1); err != nil {
+			t.Fatalf("WaitStreams: %v", err)
+		}
+		srv.Inject(
+			&types.Tweet{Text: "cat 2", AuthorID: "1"},
+			&types.Tweet{Text: "cat 3", AuthorID: "1"},
+			&types.Tweet{Text: "cat 4", AuthorID: "1"},
+		)
+		if err := <-done; err != nil {
+			t.Errorf("Stream: unexpected error: %v", err)
+		}
+		close(got)
+		var texts []string
+		for text := range got {
+			texts = append(texts, text)
+		}
+		if len(texts) != 2 || texts[0] != "cat 2" || texts[1] != "cat 3" {
+			t.Errorf("Got %q, want cat 2 and cat 3", texts)
+		}
+
+		want := []tweets.ReconnectEvent{
+			{Attempt: 1, Delay: 2 * time.Millisecond},              // 503
+			{Attempt: 2, Delay: 4 * time.Millisecond},              // 503
+			{Attempt: 1, Delay: 1 * time.Millisecond, Results: 1},  // closed
+			{Attempt: 2, Delay: 10 * time.Millisecond, Results: 1}, // 429
+		}
+		evs := takeEvents()
+		if len(evs) != len(want) {
+			t.Fatalf("Events: got %+v, want %d", evs, len(want))
+		}
+		for i, e := range evs {
+			w := want[i]
+			if e.Attempt != w.Attempt || e.Delay != w.Delay || e.Results != w.Results {
+				t.Errorf("Event %d: got %+v, want %+v", i+1, e, w)
+			}
+		}
+		var herr *jhttp.Error
+		if err := evs[0].Err; !errors.As(err, &herr) || herr.Status != http.StatusServiceUnavailable {
+			t.Errorf("Event 1: got error %v, want status 503", err)
+		}
+		if err := evs[2].Err; err != nil {
+			t.Errorf("Event 3: got error %v, want nil", err)
+		}
+		if err := evs[3].Err; !errors.Is(err, twitter.ErrRateLimited) {
+			t.Errorf("Event 4: got error %v, want rate limited", err)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		// System events do not count toward the maximum number of results.
+		// Use a separate server, so that no streams from other tests linger.
+		srv := twittertest.NewServer(&twittertest.Seed{
+			Users: []*types.User{{ID: "1", Username: "alice"}},
+		})
+		defer srv.Close()
+		cli := srv.Client()
+		if _, err := rules.Update(rules.Adds{{Query: "cat"}}).Invoke(ctx, cli); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		got := make(chan *tweets.Reply, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- tweets.SearchStream(func(rsp *tweets.Reply) error {
+				got <- rsp
+				return nil
+			}, &tweets.StreamOpts{MaxResults: 1}).Invoke(ctx, cli)
+		}()
+		if err := srv.WaitStreams(ctx, 1); err != nil {
+			t.Fatalf("WaitStreams: %v", err)
+		}
+		srv.StreamError("Stream Error", "something happened")
+		srv.Inject(&types.Tweet{Text: "cat 5", AuthorID: "1"})
+		if err := <-done; err != nil {
+			t.Errorf("Stream: unexpected error: %v", err)
+		}
+		close(got)
+		var kinds []string
+		for rsp := range got {
+			for _, e := range rsp.Events {
+				kinds = append(kinds, e.Kind.String())
+			}
+			for _, tw := range rsp.Tweets {
+				kinds = append(kinds, tw.Text)
+			}
+		}
+		if len(kinds) != 2 || kinds[0] != "Error" || kinds[1] != "cat 5" {
+			t.Errorf("Stream: got %q, want an error event and cat 5", kinds)
+		}
+	})
+
+	t.Run("GiveUp", func(t *testing.T) {
+		// Client errors are not retried.
+		srv.RefuseStreams(1, http.StatusForbidden)
+		err := tweets.SearchStream(func(*tweets.Reply) error { return nil },
+			&tweets.StreamOpts{Reconnect: policy}).Invoke(ctx, cli)
+		if !errors.Is(err, twitter.ErrForbidden) {
+			t.Errorf("Stream: got %v, want forbidden", err)
+		}
+
+		// Local errors, such as a failure to authorize, are not retried.
+		unauth := srv.Client()
+		unauth.Authorize = func(*http.Request) error { return errors.New("no credentials") }
+		err = tweets.SearchStream(func(*tweets.Reply) error { return nil },
+			&tweets.StreamOpts{Reconnect: policy}).Invoke(ctx, unauth)
+		var herr *jhttp.Error
+		if !errors.As(err, &herr) || herr.Message != "attaching authorization" {
+			t.Errorf("Stream: got %v, want authorization error", err)
+		}
+		if got := takeEvents(); len(got) != 0 {
+			t.Errorf("Events: got %+v, want none", got)
+		}
+
+		// Other persistent local failures return at once, even without a limit
+		// on the number of attempts.
+		secure := httptest.NewTLSServer(http.NotFoundHandler())
+		defer secure.Close()
+		for _, base := range []string{"ftp://example.invalid/", secure.URL} {
+			bad := twitter.NewClient(&jhttp.Client{BaseURL: base})
+			err := tweets.SearchStream(func(*tweets.Reply) error { return nil },
+				&tweets.StreamOpts{Reconnect: policy}).Invoke(ctx, bad)
+			if err == nil {
+				t.Errorf("Stream %q: got nil, want error", base)
+			}
+			if got := takeEvents(); len(got) != 0 {
+				t.Errorf("Stream %q: got events %+v, want none", base, got)
+			}
+		}
+
+		// A refused connection is retried.
+		gone := httptest.NewServer(http.NotFoundHandler())
+		gone.Close()
+		once := *policy
+		once.MaxAttempts = 1
+		err = tweets.SearchStream(func(*tweets.Reply) error { return nil },
+			&tweets.StreamOpts{Reconnect: &once}).Invoke(ctx, twitter.NewClient(&jhttp.Client{BaseURL: gone.URL}))
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Errorf("Stream: got %v, want connection refused", err)
+		}
+		if got := takeEvents(); len(got) != 1 {
+			t.Errorf("Events: got %+v, want 1", got)
+		}
+
+		// Transient errors are retried up to the limit.
+		srv.RefuseStreams(3, http.StatusBadGateway)
+		limited := *policy
+		limited.MaxAttempts = 2
+		err = tweets.SearchStream(func(*tweets.Reply) error { return nil },
+			&tweets.StreamOpts{Reconnect: &limited}).Invoke(ctx, cli)
+		if !errors.As(err, &herr) || herr.Status != http.StatusBadGateway {
+			t.Errorf("Stream: got %v, want status 502", err)
+		}
+		if got := takeEvents(); len(got) != 2 {
+			t.Errorf("Events: got %+v, want 2", got)
+		}
+		srv.RefuseStreams(0, 0)
+	})
+	t.Run("Stall", func(t *testing.T) {
+		// A stalled stream is reconnected as for a network error.
+		stalling := srv.Client()
+		stalling.StallTimeout = 20 * time.Millisecond
+		var m twitter.StreamMonitor
+		limited := *policy
+		limited.MaxAttempts = 1
+		err := tweets.SearchStream(func(*tweets.Reply) error { return nil },
+			&tweets.StreamOpts{Reconnect: &limited, Monitor: &m}).Invoke(ctx, stalling)
+		if !errors.Is(err, twitter.ErrStreamStalled) {
+			t.Errorf("Stream: got %v, want %v", err, twitter.ErrStreamStalled)
+		}
+		evs := takeEvents()
+		if len(evs) != 1 || !errors.Is(evs[0].Err, twitter.ErrStreamStalled) || evs[0].Delay != policy.NetworkDelay {
+			t.Errorf("Events: got %+v, want 1 stall", evs)
+		}
+		if h := m.Health(); h.Stalls != 2 || h.Open {
+			t.Errorf("Health: got %+v, want 2 stalls", h)
+		}
+	})
+}
+
+func TestStreamEmptyMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("{}\r\n" + `{"data":{"id":"1","text":"cat"}}` + "\r\n"))
+	}))
+	defer srv.Close()
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+	// A message with neither data nor errors is skipped, and does not end the
+	// stream.
+	var got []string
+	err := tweets.SearchStream(func(rsp *tweets.Reply) error {
+		if len(rsp.Tweets) != 1 || len(rsp.Events) != 0 {
+			t.Errorf("Reply: got %+v, want one tweet", rsp)
+		}
+		for _, tw := range rsp.Tweets {
+			got = append(got, tw.Text)
+		}
+		return nil
+	}, nil).Invoke(context.Background(), cli)
+	if err != nil {
+		t.Errorf("Stream: unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0] != "cat" {
+		t.Errorf("Stream: got %q, want [cat]", got)
+	}
+}
+
+func TestStreamEventReply(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"data":{"id":"1","text":"cat 1"},"matching_rules":[{"id":"10","tag":"cats"}]}` + "\r\n" +
+			`{"errors":[{"title":"Stream Error","detail":"something happened"}]}` + "\r\n" +
+			`{"data":{"id":"2","text":"cat 2"},"matching_rules":[{"id":"10","tag":"cats"}]}` + "\r\n"))
+	}))
+	defer srv.Close()
+	cli := twitter.NewClient(&jhttp.Client{BaseURL: srv.URL})
+
+	// A callback that routes tweets by rule tag, as in the package example,
+	// sees a system message as a reply with events and no tweets.
+	var routed []string
+	var events int
+	err := tweets.SearchStream(func(rsp *tweets.Reply) error {
+		if len(rsp.Tweets) != 0 {
+			for _, r := range rsp.MatchingRules {
+				routed = append(routed, r.Tag+": "+rsp.Tweets[0].Text)
+			}
+		} else if len(rsp.Events) != 0 {
+			events++
+		} else {
+			t.Errorf("Reply: got %+v, want a tweet or events", rsp)
+		}
+		return nil
+	}, nil).Invoke(context.Background(), cli)
+	if err != nil {
+		t.Errorf("Stream: unexpected error: %v", err)
+	}
+	if want := []string{"cats: cat 1", "cats: cat 2"}; fmt.Sprint(routed) != fmt.Sprint(want) || events != 1 {
+		t.Errorf("Stream: got %q and %d events, want %q and 1 event", routed, events, want)
+	}
+}
@@ -12,6 +12,9 @@
 //	   More: []string{id2, id3},
 //	})
 //
+// The API accepts at most 100 IDs per request. To look up more, use
+// tweets.BulkLookup, which splits the IDs into batches and merges the results.
+//
 // By default only the default fields are returned (see types.Tweet). To
 // request additional fields or expansions, include them in the options:
 //
@@ -31,8 +34,32 @@
 // any attachments resulting from expansions can be fetched using methods on
 // the *Reply, e.g., rsp.IncludedTweets. Note that tweet IDs that could not be
 // found or accessed (e.g., for deleted or protected tweets) are not reported
-// as an error. Instead. the caller should examine the ErrorDetail messages in
-// the Errors field of the Reply, if requested tweets are not listed.
+// as an error. Instead, the Results field of the Reply maps each requested ID
+// to the tweet, or to the ErrorDetail explaining why it was not returned:
+//
+//	for id, r := range rsp.Results {
+//	   switch r.Status() {
+//	   case types.StatusFound:
+//	      process(r.Tweet)
+//	   case types.StatusSuspended, types.StatusProtected:
+//	      // ...
+//	   }
+//	}
+//
+// To join the tweets of a reply with the objects they refer to, use Hydrate.
+// Each hydrated tweet links to its author, media, polls, place, and the tweets
+// it references, as resolved from the expansions included in the reply:
+//
+//	hs, err := rsp.Hydrate()
+//	for _, h := range hs {
+//	   fmt.Println(h.Author.Username, h.Text)
+//	   if q := h.Ref("quoted"); q != nil {
+//	      fmt.Println("  quoting", q.Author.Username, q.Text)
+//	   }
+//	}
+//
+// References that are not resolved, for example because the expansion was
+// not requested, are reported in the Missing field of each hydrated tweet.
 //
 // # Search
 //
@@ -56,6 +83,15 @@
 //
 // Use q.ResetPageToken to reset the query.
 //
+// A Query also satisfies the twitter.Pageable interface, so that its results
+// can be iterated with a twitter.Pager:
+//
+//	p := twitter.NewPager(q, &twitter.PagerOpts{MaxPages: 10})
+//	err := p.EachItem(ctx, cli, func(v interface{}) error {
+//	   tweet := v.(*types.Tweet)
+//	   // ...
+//	})
+//
 // # Streaming
 //
 // Streaming queries take a callback that receives each response sent by the
@@ -73,6 +109,20 @@
 //	   return nil
 //	}, nil)
 //
+// Each reply from a search stream reports the rules the tweet matched, which
+// can be used to route tweets by rule tag:
+//
+//	if len(rsp.Tweets) != 0 {
+//	   for _, r := range rsp.MatchingRules {
+//	      route(r.Tag, rsp.Tweets[0])
+//	   }
+//	}
+//
+// Messages from the server that carry no tweet, such as notice of an
+// operational disconnect, are delivered as a reply with Events and no Tweets,
+// so a callback must check for a tweet before using it, as above. These
+// replies do not count toward the MaxResults stream option.
+//
 // If the callback returns jhttp.ErrStopStreaming, the stream is terminated
 // without error; otherwise the error returned by the callback is reported to
 // the caller of the query. For the common and simple case of limiting the
@@ -86,6 +136,16 @@
 //	      types.MediaFields{PublicMetrics: true},
 //	   },
 //	}
+//
+// By default, a stream ends when the server closes the connection or an error
+// occurs. To reconnect automatically with the recommended backoff, set the
+// Reconnect option:
+//
+//	opts := &tweets.StreamOpts{Reconnect: &tweets.ReconnectPolicy{
+//	   OnReconnect: func(e tweets.ReconnectEvent) {
+//	      log.Printf("Reconnecting in %v (attempt %d): %v", e.Delay, e.Attempt, e.Err)
+//	   },
+//	}}
 package tweets
 
 import (
@@ -175,14 +235,13 @@ func BookmarkedBy(userID string, opts *ListOpts) Query {
 // A Query performs a lookup or search query.
 type Query struct {
 	*jhttp.Request
-	encodeErr error
+	encodeErr  error
+	tokenParam string // if set, overrides twitter.NextTokenParam
 }
 
 func (q Query) nextTokenParam() string {
-	// N.B. For some reason the "search recent" API uses a different pagination
-	// token parameter the rest of the API.
-	if q.Request.Method == "2/tweets/search/recent" {
-		return "next_token"
+	if q.tokenParam != "" {
+		return q.tokenParam
 	}
 	return twitter.NextTokenParam
 }
@@ -210,8 +269,15 @@ func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error)
 	if err != nil {
 		return nil, &jhttp.Error{Data: rsp.Data, Message: "decoding tweet data", Err: err}
 	}
+	if ids, ok := q.Request.Params["ids"]; ok {
+		out.Results = lookupResults(ids, out.Tweets, rsp.Errors)
+	}
 
-	// Maintain the flag validity for lookup queries.
+	// Maintain the flag validity for lookup queries. Some queries, such as
+	// Create, have no parameters of their own.
+	if q.Request.Params == nil {
+		q.Request.Params = make(jhttp.Params)
+	}
 	q.Request.Params.Set(q.nextTokenParam(), "")
 	if len(rsp.Meta) != 0 {
 		if err := json.Unmarshal(rsp.Meta, &out.Meta); err != nil {
@@ -243,11 +309,68 @@ func (q Query) HasMorePages() bool {
 // invoking the query will then fetch the first page of results.
 func (q Query) ResetPageToken() { q.Request.Params.Reset(q.nextTokenParam()) }
 
+// FetchPage invokes the query to fetch the next page of results. The page
+// reply is a *Reply, and its items are *types.Tweet values. This method
+// satisfies the twitter.Pageable interface.
+func (q Query) FetchPage(ctx context.Context, cli *twitter.Client) (*twitter.Page, error) {
+	rsp, err := q.Invoke(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, len(rsp.Tweets))
+	for i, t := range rsp.Tweets {
+		items[i] = t
+	}
+	return &twitter.Page{Reply: rsp, Items: items}, nil
+}
+
 // A Reply is the response from a Query.
 type Reply struct {
 	*twitter.Reply
 	Tweets types.Tweets
 	Meta   *twitter.Pagination
+
+	// For streaming queries, the system events reported by a message that
+	// has no tweet. A streaming reply has either one tweet or some events.
+	Events []*StreamEvent
+
+	// For lookup queries, a map from each requested tweet ID to the result of
+	// looking up that ID. This is nil for other queries.
+	Results map[string]*LookupResult
+}
+
+// A LookupResult reports the outcome of looking up a single tweet ID.
+type LookupResult struct {
+	Tweet *types.Tweet       // the tweet, if it was found
+	Error *types.ErrorDetail // why the tweet was not found, if reported
+}
+
+// Status reports the status of the requested tweet.
+func (r *LookupResult) Status() types.ResourceStatus {
+	if r.Tweet != nil {
+		return types.StatusFound
+	} else if r.Error != nil {
+		return r.Error.Status()
+	}
+	return types.StatusNotFound
+}
+
+func lookupResults(ids []string, tweets types.Tweets, errs []*types.ErrorDetail) map[string]*LookupResult {
+	out := make(map[string]*LookupResult, len(ids))
+	for _, id := range ids {
+		out[id] = new(LookupResult)
+	}
+	for _, t := range tweets {
+		if r, ok := out[t.ID]; ok {
+			r.Tweet = t
+		}
+	}
+	for _, e := range errs {
+		if r, ok := out[e.Value]; ok && e.Parameter == "ids" && r.Tweet == nil {
+			r.Error = e
+		}
+	}
+	return out
 }
 
 // LookupOpts provides parameters for tweet lookup. A nil *LookupOpts provides
@@ -21,6 +21,11 @@
 //	}
 //	process(rsp.Users)
 //
+// The Client wraps the *jhttp.Client passed to NewClient, which it shares
+// with the caller: changes to the fields of the *jhttp.Client after the call
+// affect the Client. A *jhttp.Client cannot be converted directly to a
+// *Client; use NewClient.
+//
 // # Packages
 //
 // Package "types" contains the type and constant definitions for the API.
@@ -34,11 +39,103 @@
 //
 // Queries to create, edit, delete, and show the contents of lists are defined
 // in package "lists".
+//
+// # Rate limits
+//
+// The server reports rate limit metadata with each reply. To have the client
+// track these limits and check them before sending a request, set a Limiter:
+//
+//	cli.Limiter = &twitter.Limiter{Wait: true}
+//
+// Limits are tracked separately for each endpoint (see Endpoint). When a
+// request would exceed the limit for its endpoint, the client either waits
+// until the limit resets (if Wait is true) or fails immediately with a
+// *LimitError.
+//
+// # Credential pools
+//
+// To spread calls across several credentials, for example the bearer tokens
+// of several apps, set a CredentialPool:
+//
+//	cli.Credentials = twitter.NewCredentialPool(
+//	   twitter.Credential{Name: "app1", Authorize: jhttp.BearerTokenAuthorizer(token1)},
+//	   twitter.Credential{Name: "app2", Authorize: jhttp.BearerTokenAuthorizer(token2)},
+//	)
+//
+// The pool authorizes each call with the credential that has the most quota
+// remaining for the endpoint, fails over to another credential when one is
+// rate limited, and quarantines credentials the server rejects as
+// unauthorized.
+//
+// # Retries
+//
+// To have the client retry calls that fail with transient errors, such as
+// HTTP 429 and 5xx statuses or reset connections, set a RetryPolicy:
+//
+//	cli.Retry = &twitter.RetryPolicy{
+//	   MaxAttempts: 5,
+//	   Deadline:    2 * time.Minute,
+//	}
+//
+// The client waits between attempts using exponential backoff with jitter,
+// and honors the Retry-After and x-rate-limit-reset headers reported by the
+// server. Requests that are not idempotent, such as a POST to create a tweet,
+// are retried only after HTTP 429, unless the policy sets RetryUnsafe.
+//
+// # Errors
+//
+// When the server reports an error, the error returned by the client wraps an
+// *APIError describing the problem. Use errors.Is with the sentinel errors
+// defined by this package to classify it:
+//
+//	rsp, err := q.Invoke(ctx, cli)
+//	if errors.Is(err, twitter.ErrRateLimited) {
+//	   // back off and try again later
+//	}
+//
+// Partial errors reported in the Errors field of a Reply can be converted to
+// an *APIError using DetailError.
+//
+// # Interceptors
+//
+// To observe or modify the calls issued by a client, for example to record
+// an audit log, collect metrics, serve cached results, or inject faults, add
+// an Interceptor:
+//
+//	cli.Interceptors = append(cli.Interceptors, func(ctx context.Context, ex *twitter.Exchange, next twitter.Handler) error {
+//	   err := next(ctx, ex)
+//	   log.Printf("%v %s: %v", ex.Kind, ex.Request.Method, err)
+//	   return err
+//	})
+//
+// Each interceptor receives an Exchange describing the call, and a handler to
+// continue the chain. After next returns, the Exchange holds the response
+// headers and, depending on the kind of call, the raw or decoded response.
+// Package metrics provides an interceptor that collects per-endpoint metrics.
+//
+// # Stalled streams
+//
+// A connection that fails without being closed can leave a stream waiting
+// indefinitely. To detect this, set a StallTimeout on the client:
+//
+//	cli.StallTimeout = time.Minute
+//
+// A stream that receives no messages or keep-alives for this long is closed,
+// and reports an error wrapping ErrStreamStalled. To observe the health of a
+// stream while it runs, for example the time since it last received data,
+// use StreamMonitored with a StreamMonitor.
+//
+// # Pagination
+//
+// Queries that return results in pages satisfy the Pageable interface. Use a
+// Pager to iterate over their results page by page, or item by item, with
+// optional limits on the number of pages and items fetched.
 package twitter
 
 import (
 	"context"
-	"encoding/json"
+	"net/http"
+	"time"
 
 	"github.com/creachadair/jhttp"
 )
@@ -56,6 +153,9 @@ const (
 // NewClient returns a new client for the Twitter API.
 // If cli == nil, default client options are used targeting the production API
 // at BaseURL.
+//
+// The new client shares cli rather than copying it, so later changes to the
+// fields of cli, such as its Authorize function, affect the client.
 func NewClient(cli *jhttp.Client) *Client {
 	if cli == nil {
 		cli = new(jhttp.Client)
@@ -63,11 +163,42 @@ func NewClient(cli *jhttp.Client) *Client {
 	if cli.BaseURL == "" {
 		cli.BaseURL = BaseURL
 	}
-	return (*Client)(cli)
+	return &Client{Client: cli}
 }
 
-// A Client serves as a client for the Twitter API v2.
-type Client jhttp.Client
+// A Client serves as a client for the Twitter API v2. Use NewClient to
+// construct a client; the zero value is not ready for use.
+//
+// Earlier versions of this package defined Client as a conversion of
+// jhttp.Client. Code that converts a *jhttp.Client to a *Client must now use
+// NewClient instead.
+type Client struct {
+	*jhttp.Client
+
+	// If non-nil, the client records the rate limits reported by the server
+	// and checks them before sending each request.
+	Limiter *Limiter
+
+	// If non-nil, each call is authorized by a credential chosen from this
+	// pool, instead of by Authorize. The pool tracks rate limits separately for
+	// each credential, and the Limiter is not consulted.
+	Credentials *CredentialPool
+
+	// If non-nil, the client retries calls that fail with transient errors
+	// according to this policy.
+	Retry *RetryPolicy
+
+	// If set, each call issued by the client passes through these
+	// interceptors, in order, so the first is outermost. Interceptors see each
+	// call once; retries happen inside the chain.
+	Interceptors []Interceptor
+
+	// If positive, a stream that receives nothing from the server, not even a
+	// keep-alive, for this long is closed with an error wrapping
+	// ErrStreamStalled. The API sends a keep-alive every 20 seconds on an
+	// otherwise idle stream.
+	StallTimeout time.Duration
+}
 
 // A Callback function is invoked for each reply received in a stream.  If the
 // callback reports a non-nil error, the stream is terminated. If the error is
@@ -75,35 +206,74 @@ type Client jhttp.Client
 type Callback func(*Reply) error
 
 // Call issues the specified API request and returns the decoded reply.
-// Errors from Call have concrete type *jhttp.Error.
+// Errors from Call have concrete type *jhttp.Error. If the server reported an
+// error, the *jhttp.Error wraps an *APIError describing it.
 func (c *Client) Call(ctx context.Context, req *jhttp.Request) (*Reply, error) {
-	header, body, err := (*jhttp.Client)(c).Call(ctx, req)
-	if err != nil {
+	ex := &Exchange{Kind: KindCall, Request: req}
+	if err := c.exchange(ctx, ex, c.invoke); err != nil {
 		return nil, err
+	} else if ex.Reply == nil {
+		return decodeReply(ex.Header, ex.Body)
 	}
-	var reply Reply
-	if err := json.Unmarshal(body, &reply); err != nil {
-		return nil, &jhttp.Error{Data: body, Message: "decoding response body", Err: err}
-	}
-	reply.RateLimit = decodeRateLimits(header)
-	return &reply, nil
+	return ex.Reply, nil
 }
 
 // CallRaw issues the specified API request and returns the raw response body
-// without decoding. Errors from CallRaw have concrete type *jhttp.Error
+// without decoding. Errors from CallRaw have concrete type *jhttp.Error, as for
+// Call.
 func (c *Client) CallRaw(ctx context.Context, req *jhttp.Request) ([]byte, error) {
-	_, body, err := (*jhttp.Client)(c).Call(ctx, req)
-	return body, err
+	ex := &Exchange{Kind: KindCallRaw, Request: req}
+	err := c.exchange(ctx, ex, c.invoke)
+	return ex.Body, err
+}
+
+// call issues req on the underlying client, retrying transient failures as
+// specified by c.Retry, if set.
+func (c *Client) call(ctx context.Context, req *jhttp.Request) (http.Header, []byte, error) {
+	if c.Retry == nil {
+		return c.callOnce(ctx, req)
+	}
+	return c.Retry.call(ctx, req, func(ctx context.Context) (http.Header, []byte, error) {
+		return c.callOnce(ctx, req)
+	})
+}
+
+// callOnce issues req on the underlying client, authorized by a credential
+// from c.Credentials if set, or otherwise subject to the rate limits recorded
+// by c.Limiter, if any.
+func (c *Client) callOnce(ctx context.Context, req *jhttp.Request) (http.Header, []byte, error) {
+	key := Endpoint(req)
+	if c.Credentials != nil {
+		var header http.Header
+		var body []byte
+		err := c.Credentials.call(ctx, key, func(auth jhttp.Authorizer) (http.Header, error) {
+			cli := *c.Client // shallow copy
+			cli.Authorize = auth
+			var err error
+			header, body, err = cli.Call(ctx, req)
+			return header, withAPIError(err)
+		})
+		return header, body, err
+	}
+	if err := c.Limiter.acquire(ctx, key); err != nil {
+		return nil, nil, err
+	}
+	header, body, err := c.Client.Call(ctx, req)
+	c.Limiter.update(key, decodeRateLimits(header))
+	return header, body, withAPIError(err)
 }
 
 // Stream issues the specified API request and streams results to the given
-// callback. Errors from Stream have concrete type *jhttp.Error.
+// callback. Errors from Stream have concrete type *jhttp.Error, as for Call.
 func (c *Client) Stream(ctx context.Context, req *jhttp.Request, f Callback) error {
-	return (*jhttp.Client)(c).Stream(ctx, req, func(body []byte) error {
-		var reply Reply
-		if err := json.Unmarshal(body, &reply); err != nil {
-			return &jhttp.Error{Data: body, Message: "decoding stream response", Err: err}
-		}
-		return f(&reply)
-	})
+	return c.StreamMonitored(ctx, req, nil, f)
+}
+
+// StreamMonitored is as Stream, but records the health of the stream in m.
+// If m == nil, the health of the stream is not reported to the caller.
+func (c *Client) StreamMonitored(ctx context.Context, req *jhttp.Request, m *StreamMonitor, f Callback) error {
+	if m == nil {
+		m = new(StreamMonitor)
+	}
+	return c.exchange(ctx, &Exchange{Kind: KindStream, Request: req, Callback: f, Monitor: m}, c.stream)
 }
@@ -0,0 +1,788 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twittertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/types"
+)
+
+// routes lists the endpoints served by a Server. Routes are matched in order,
+// so literal segments must precede parameters in the same position.
+var routes = []route{
+	// Tweets
+	{"GET", "tweets", (*Server).lookupTweets},
+	{"POST", "tweets", (*Server).createTweet},
+	{"GET", "tweets/search/recent", (*Server).searchRecent},
+	{"GET", "tweets/search/stream", (*Server).searchStream},
+	{"GET", "tweets/search/stream/rules", (*Server).getRules},
+	{"POST", "tweets/search/stream/rules", (*Server).updateRules},
+	{"DELETE", "tweets/:id", (*Server).deleteTweet},
+	{"PUT", "tweets/:id/hidden", (*Server).hideReplies},
+	{"GET", "tweets/:id/quote_tweets", (*Server).quoteTweets},
+	{"GET", "tweets/:id/retweeted_by", (*Server).retweetedBy},
+	{"GET", "tweets/:id/liking_users", (*Server).likingUsers},
+
+	// Users
+	{"GET", "users", (*Server).lookupUsers},
+	{"GET", "users/by", (*Server).lookupUsers},
+	{"GET", "users/:id/followers", (*Server).followers},
+	{"GET", "users/:id/following", (*Server).following},
+	{"GET", "users/:id/blocking", (*Server).blocking},
+	{"GET", "users/:id/muting", (*Server).muting},
+	{"POST", "users/:id/following", (*Server).follow},
+	{"DELETE", "users/:id/following/:other", (*Server).unfollow},
+	{"POST", "users/:id/blocking", (*Server).block},
+	{"DELETE", "users/:id/blocking/:other", (*Server).unblock},
+	{"POST", "users/:id/muting", (*Server).mute},
+	{"DELETE", "users/:id/muting/:other", (*Server).unmute},
+
+	{"GET", "users/:id/tweets", (*Server).userTweets},
+	{"GET", "users/:id/mentions", (*Server).mentions},
+	{"GET", "users/:id/liked_tweets", (*Server).likedTweets},
+	{"GET", "users/:id/bookmarks", (*Server).bookmarks},
+	{"POST", "users/:id/likes", (*Server).like},
+	{"DELETE", "users/:id/likes/:tid", (*Server).unlike},
+	{"POST", "users/:id/bookmarks", (*Server).bookmark},
+	{"DELETE", "users/:id/bookmarks/:tid", (*Server).unbookmark},
+	{"POST", "users/:id/retweets", (*Server).retweet},
+	{"DELETE", "users/:id/retweets/:tid", (*Server).unretweet},
+
+	{"GET", "users/:id/owned_lists", (*Server).ownedLists},
+	{"GET", "users/:id/followed_lists", (*Server).followedLists},
+	{"GET", "users/:id/pinned_lists", (*Server).pinnedLists},
+	{"GET", "users/:id/list_memberships", (*Server).listMemberships},
+	{"POST", "users/:id/pinned_lists", (*Server).pinList},
+	{"DELETE", "users/:id/pinned_lists/:lid", (*Server).unpinList},
+
+	// Lists
+	{"POST", "lists", (*Server).createList},
+	{"GET", "lists/:id", (*Server).lookupList},
+	{"PUT", "lists/:id", (*Server).updateList},
+	{"DELETE", "lists/:id", (*Server).deleteList},
+	{"GET", "lists/:id/members", (*Server).listMembers},
+	{"GET", "lists/:id/followers", (*Server).listFollowers},
+	{"GET", "lists/:id/tweets", (*Server).listTweets},
+	{"POST", "lists/:id/members", (*Server).addMember},
+	{"DELETE", "lists/:id/members/:uid", (*Server).removeMember},
+}
+
+// Pagination parameters for the various kinds of endpoint.
+var (
+	searchPages   = pageSpec{param: "next_token", def: 10, min: 10, max: 100}
+	timelinePages = pageSpec{param: "pagination_token", def: 10, min: 5, max: 100}
+	tweetPages    = pageSpec{param: "pagination_token", def: 100, min: 1, max: 100}
+	followPages   = pageSpec{param: "pagination_token", def: 100, min: 1, max: 1000}
+	userPages     = pageSpec{param: "pagination_token", def: 100, min: 1, max: 100}
+	listPages     = pageSpec{param: "pagination_token", def: 100, min: 1, max: 100}
+)
+
+// sendTweets writes a page of the given tweet IDs.
+func (s *Server) sendTweets(c *call, ids []string, spec pageSpec) {
+	page, meta, ok := c.page(s.existing(ids, func(id string) bool { return s.tweets[id] != nil }), spec)
+	if !ok {
+		return
+	}
+	r := s.newResponse(c)
+	var data []json.RawMessage
+	for _, id := range page {
+		data = append(data, r.tweet(s.tweets[id]))
+	}
+	if len(page) != 0 {
+		meta["newest_id"] = page[0]
+		meta["oldest_id"] = page[len(page)-1]
+	}
+	r.send(data, meta)
+}
+
+// sendUsers writes a page of the given user IDs.
+func (s *Server) sendUsers(c *call, ids []string, spec pageSpec) {
+	page, meta, ok := c.page(s.existing(ids, func(id string) bool { return s.users[id] != nil }), spec)
+	if !ok {
+		return
+	}
+	r := s.newResponse(c)
+	var data []json.RawMessage
+	for _, id := range page {
+		data = append(data, r.user(s.users[id]))
+	}
+	r.send(data, meta)
+}
+
+// sendLists writes a page of the given list IDs.
+func (s *Server) sendLists(c *call, ids []string, spec pageSpec) {
+	page, meta, ok := c.page(s.existing(ids, func(id string) bool { return s.lists[id] != nil }), spec)
+	if !ok {
+		return
+	}
+	r := s.newResponse(c)
+	var data []json.RawMessage
+	for _, id := range page {
+		data = append(data, r.list(s.lists[id]))
+	}
+	r.send(data, meta)
+}
+
+// existing returns the elements of ids for which ok reports true.
+func (s *Server) existing(ids []string, ok func(string) bool) []string {
+	var out []string
+	for _, id := range ids {
+		if ok(id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// checkUser reports whether the user identified by the first argument of c
+// exists. If not, it writes a not-found response.
+func (s *Server) checkUser(c *call) bool {
+	if s.users[c.args[0]] != nil {
+		return true
+	}
+	r := s.newResponse(c)
+	r.notFound("user", "id", c.args[0])
+	r.send(nil, nil)
+	return false
+}
+
+// checkTweet reports whether the tweet identified by the first argument of c
+// exists. If not, it writes a not-found response.
+func (s *Server) checkTweet(c *call) bool {
+	if s.tweets[c.args[0]] != nil {
+		return true
+	}
+	r := s.newResponse(c)
+	r.notFound("tweet", "id", c.args[0])
+	r.send(nil, nil)
+	return false
+}
+
+// checkList reports whether the list identified by the first argument of c
+// exists. If not, it writes a not-found response.
+func (s *Server) checkList(c *call) bool {
+	if s.lists[c.args[0]] != nil {
+		return true
+	}
+	r := s.newResponse(c)
+	r.notFound("list", "id", c.args[0])
+	r.send(nil, nil)
+	return false
+}
+
+// checkMe reports whether the server has an authenticated user. If not, it
+// writes an error response.
+func (s *Server) checkMe(c *call) bool {
+	if s.me != "" {
+		return true
+	}
+	writeProblem(c.w, http.StatusForbidden, "Unsupported Authentication", problemBase+"unsupported-authentication",
+		"Authenticating with OAuth 2.0 Application-Only is forbidden for this endpoint.")
+	return false
+}
+
+// Tweets
+
+func (s *Server) lookupTweets(c *call) {
+	ids := c.list("ids")
+	if len(ids) == 0 || len(ids) > 100 {
+		c.invalid("The `ids` query parameter must have between 1 and 100 values")
+		return
+	}
+	r := s.newResponse(c)
+	var data []json.RawMessage
+	for _, id := range ids {
+		if t := s.tweets[id]; t != nil {
+			data = append(data, r.tweet(t))
+		} else {
+			r.notFound("tweet", "ids", id)
+		}
+	}
+	r.send(data, nil)
+}
+
+func (s *Server) createTweet(c *call) {
+	if !s.checkMe(c) {
+		return
+	}
+	var req struct {
+		Text    string `json:"text"`
+		QuoteID string `json:"quote_tweet_id"`
+		Reply   *struct {
+			InReplyTo string `json:"in_reply_to_tweet_id"`
+		} `json:"reply"`
+		Poll *struct {
+			Options  []string      `json:"options"`
+			Duration types.Minutes `json:"duration_minutes"`
+		} `json:"poll"`
+	}
+	if !c.decode(&req) {
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	t := &types.Tweet{
+		ID:        s.newIDLocked(),
+		Text:      req.Text,
+		AuthorID:  s.me,
+		CreatedAt: &now,
+		Source:    "twittertest",
+	}
+	t.ConversationID = t.ID
+	if mentions := parseMentions(req.Text); len(mentions) != 0 {
+		t.Entities = &types.Entities{Mentions: mentions}
+	}
+	if id := req.QuoteID; id != "" {
+		if s.tweets[id] == nil {
+			c.invalid("The quoted tweet " + id + " does not exist")
+			return
+		}
+		t.Referenced = append(t.Referenced, &types.Ref{Type: "quoted", ID: id})
+	}
+	if req.Reply != nil && req.Reply.InReplyTo != "" {
+		parent := s.tweets[req.Reply.InReplyTo]
+		if parent == nil {
+			c.invalid("The replied-to tweet " + req.Reply.InReplyTo + " does not exist")
+			return
+		}
+		t.Referenced = append(t.Referenced, &types.Ref{Type: "replied_to", ID: parent.ID})
+		t.InReplyTo = parent.AuthorID
+		if parent.ConversationID != "" {
+			t.ConversationID = parent.ConversationID
+		}
+	}
+	if req.Poll != nil && len(req.Poll.Options) != 0 {
+		p := &types.Poll{ID: s.newIDLocked(), Duration: req.Poll.Duration, VotingStatus: "open"}
+		for i, opt := range req.Poll.Options {
+			p.Options = append(p.Options, &types.PollOption{Position: i + 1, Label: opt})
+		}
+		end := now.Add(time.Duration(req.Poll.Duration))
+		p.EndTime = &end
+		s.polls[p.ID] = p
+		t.Attachments = types.Attachments{"poll_ids": {p.ID}}
+	}
+	s.tweets[t.ID] = t
+	c.reply(map[string]interface{}{
+		"data": map[string]string{"id": t.ID, "text": t.Text},
+	})
+}
+
+func (s *Server) deleteTweet(c *call) {
+	id := c.args[0]
+	if s.tweets[id] == nil {
+		c.invalid("The tweet " + id + " does not exist")
+		return
+	}
+	delete(s.tweets, id)
+	delete(s.hidden, id)
+	s.dropLocked(id)
+	c.result("deleted", true)
+}
+
+func (s *Server) hideReplies(c *call) {
+	id := c.args[0]
+	var req struct {
+		Hidden bool `json:"hidden"`
+	}
+	if s.tweets[id] == nil {
+		c.invalid("The tweet " + id + " does not exist")
+		return
+	} else if !c.decode(&req) {
+		return
+	}
+	s.hidden[id] = req.Hidden
+	c.result("hidden", req.Hidden)
+}
+
+func (s *Server) searchRecent(c *call) {
+	q := c.param("query")
+	if q == "" {
+		c.invalid("The `query` query parameter can not be empty")
+		return
+	}
+	if msgs := s.queryProblemsLocked(q); len(msgs) != 0 {
+		c.invalid("There were errors processing your request: " + strings.Join(msgs, "; "))
+		return
+	}
+	m, err := query.CompileString(q)
+	if err != nil {
+		c.invalid("There were errors processing your request: " + err.Error())
+		return
+	}
+	since, until := c.param("since_id"), c.param("until_id")
+	ids := s.timelineLocked(func(t *types.Tweet) bool {
+		if since != "" && !idLess(since, t.ID) {
+			return false
+		} else if until != "" && !idLess(t.ID, until) {
+			return false
+		}
+		return s.matchLocked(m, t)
+	})
+	s.sendTweets(c, ids, searchPages)
+}
+
+func (s *Server) quoteTweets(c *call) {
+	if !s.checkTweet(c) {
+		return
+	}
+	id := c.args[0]
+	s.sendTweets(c, s.timelineLocked(func(t *types.Tweet) bool {
+		for _, ref := range t.Referenced {
+			if ref.Type == "quoted" && ref.ID == id {
+				return true
+			}
+		}
+		return false
+	}), timelinePages)
+}
+
+func (s *Server) retweetedBy(c *call) {
+	if s.checkTweet(c) {
+		s.sendUsers(c, s.inLocked(relRetweet, c.args[0]), userPages)
+	}
+}
+
+func (s *Server) likingUsers(c *call) {
+	if s.checkTweet(c) {
+		s.sendUsers(c, s.inLocked(relLike, c.args[0]), userPages)
+	}
+}
+
+// Users
+
+func (s *Server) lookupUsers(c *call) {
+	param, byName := "ids", strings.HasSuffix(strings.TrimSuffix(c.req.URL.Path, "/"), "/by")
+	if byName {
+		param = "usernames"
+	}
+	keys := c.list(param)
+	if len(keys) == 0 || len(keys) > 100 {
+		c.invalid("The `" + param + "` query parameter must have between 1 and 100 values")
+		return
+	}
+	r := s.newResponse(c)
+	var data []json.RawMessage
+	for _, key := range keys {
+		u := s.users[key]
+		if byName {
+			u = s.userByNameLocked(key)
+		}
+		if u != nil {
+			data = append(data, r.user(u))
+		} else {
+			r.notFound("user", param, key)
+		}
+	}
+	r.send(data, nil)
+}
+
+func (s *Server) followers(c *call) {
+	if s.checkUser(c) {
+		s.sendUsers(c, s.inLocked(relFollow, c.args[0]), followPages)
+	}
+}
+
+func (s *Server) following(c *call) {
+	if s.checkUser(c) {
+		s.sendUsers(c, s.outLocked(relFollow, c.args[0]), followPages)
+	}
+}
+
+func (s *Server) blocking(c *call) {
+	if s.checkUser(c) {
+		s.sendUsers(c, s.outLocked(relBlock, c.args[0]), followPages)
+	}
+}
+
+func (s *Server) muting(c *call) {
+	if s.checkUser(c) {
+		s.sendUsers(c, s.outLocked(relMute, c.args[0]), followPages)
+	}
+}
+
+// targetUser decodes the target user of a user-to-user edit, and reports
+// whether both users exist. If not, it writes an error response.
+func (s *Server) targetUser(c *call) (string, bool) {
+	var req struct {
+		ID string `json:"target_user_id"`
+	}
+	if !c.decode(&req) {
+		return "", false
+	} else if s.users[c.args[0]] == nil {
+		c.invalid("The user " + c.args[0] + " does not exist")
+		return "", false
+	} else if s.users[req.ID] == nil {
+		c.invalid("The target user " + req.ID + " does not exist")
+		return "", false
+	}
+	return req.ID, true
+}
+
+func (s *Server) follow(c *call) {
+	target, ok := s.targetUser(c)
+	if !ok {
+		return
+	}
+	if s.users[target].Protected && !s.hasLocked(relFollow, c.args[0], target) {
+		c.reply(map[string]interface{}{
+			"data": map[string]bool{"following": false, "pending_follow": true},
+		})
+		return
+	}
+	s.linkLocked(relFollow, c.args[0], target)
+	c.reply(map[string]interface{}{
+		"data": map[string]bool{"following": true, "pending_follow": false},
+	})
+}
+
+func (s *Server) unfollow(c *call) {
+	s.unlinkLocked(relFollow, c.args[0], c.args[1])
+	c.result("following", false)
+}
+
+func (s *Server) block(c *call) {
+	target, ok := s.targetUser(c)
+	if !ok {
+		return
+	}
+	// Blocking a user removes any follows between the two.
+	s.unlinkLocked(relFollow, c.args[0], target)
+	s.unlinkLocked(relFollow, target, c.args[0])
+	s.linkLocked(relBlock, c.args[0], target)
+	c.result("blocking", true)
+}
+
+func (s *Server) unblock(c *call) {
+	s.unlinkLocked(relBlock, c.args[0], c.args[1])
+	c.result("blocking", false)
+}
+
+func (s *Server) mute(c *call) {
+	if target, ok := s.targetUser(c); ok {
+		s.linkLocked(relMute, c.args[0], target)
+		c.result("muting", true)
+	}
+}
+
+func (s *Server) unmute(c *call) {
+	s.unlinkLocked(relMute, c.args[0], c.args[1])
+	c.result("muting", false)
+}
+
+func (s *Server) userTweets(c *call) {
+	if !s.checkUser(c) {
+		return
+	}
+	id := c.args[0]
+	s.sendTweets(c, s.timelineLocked(func(t *types.Tweet) bool {
+		return t.AuthorID == id
+	}), timelinePages)
+}
+
+func (s *Server) mentions(c *call) {
+	if !s.checkUser(c) {
+		return
+	}
+	name := s.users[c.args[0]].Username
+	s.sendTweets(c, s.timelineLocked(func(t *types.Tweet) bool {
+		if t.Entities == nil {
+			return false
+		}
+		for _, m := range t.Entities.Mentions {
+			if strings.EqualFold(m.Username, name) {
+				return true
+			}
+		}
+		return false
+	}), timelinePages)
+}
+
+func (s *Server) likedTweets(c *call) {
+	if s.checkUser(c) {
+		s.sendTweets(c, s.outLocked(relLike, c.args[0]), tweetPages)
+	}
+}
+
+func (s *Server) bookmarks(c *call) {
+	if s.checkUser(c) {
+		s.sendTweets(c, s.outLocked(relBookmark, c.args[0]), tweetPages)
+	}
+}
+
+// targetTweet decodes the target tweet of a user-to-tweet edit, and reports
+// whether the user and tweet exist. If not, it writes an error response.
+func (s *Server) targetTweet(c *call) (string, bool) {
+	var req struct {
+		ID string `json:"tweet_id"`
+	}
+	if !c.decode(&req) {
+		return "", false
+	} else if s.users[c.args[0]] == nil {
+		c.invalid("The user " + c.args[0] + " does not exist")
+		return "", false
+	} else if s.tweets[req.ID] == nil {
+		c.invalid("The tweet " + req.ID + " does not exist")
+		return "", false
+	}
+	return req.ID, true
+}
+
+func (s *Server) like(c *call) {
+	if tid, ok := s.targetTweet(c); ok {
+		s.linkLocked(relLike, c.args[0], tid)
+		c.result("liked", true)
+	}
+}
+
+func (s *Server) unlike(c *call) {
+	s.unlinkLocked(relLike, c.args[0], c.args[1])
+	c.result("liked", false)
+}
+
+func (s *Server) bookmark(c *call) {
+	if tid, ok := s.targetTweet(c); ok {
+		s.linkLocked(relBookmark, c.args[0], tid)
+		c.result("bookmarked", true)
+	}
+}
+
+func (s *Server) unbookmark(c *call) {
+	s.unlinkLocked(relBookmark, c.args[0], c.args[1])
+	c.result("bookmarked", false)
+}
+
+func (s *Server) retweet(c *call) {
+	if tid, ok := s.targetTweet(c); ok {
+		s.linkLocked(relRetweet, c.args[0], tid)
+		c.result("retweeted", true)
+	}
+}
+
+func (s *Server) unretweet(c *call) {
+	s.unlinkLocked(relRetweet, c.args[0], c.args[1])
+	c.result("retweeted", false)
+}
+
+func (s *Server) ownedLists(c *call) {
+	if !s.checkUser(c) {
+		return
+	}
+	var ids []string
+	for id, l := range s.lists {
+		if l.OwnerID == c.args[0] {
+			ids = append(ids, id)
+		}
+	}
+	sortNewestFirst(ids)
+	s.sendLists(c, ids, listPages)
+}
+
+func (s *Server) followedLists(c *call) {
+	if s.checkUser(c) {
+		s.sendLists(c, s.outLocked(relListFollow, c.args[0]), listPages)
+	}
+}
+
+func (s *Server) pinnedLists(c *call) {
+	if !s.checkUser(c) {
+		return
+	}
+	r := s.newResponse(c)
+	var data []json.RawMessage
+	for _, id := range s.outLocked(relPin, c.args[0]) {
+		if l := s.lists[id]; l != nil {
+			data = append(data, r.list(l))
+		}
+	}
+	r.send(data, map[string]interface{}{"result_count": len(data)})
+}
+
+func (s *Server) listMemberships(c *call) {
+	if s.checkUser(c) {
+		s.sendLists(c, s.inLocked(relMember, c.args[0]), listPages)
+	}
+}
+
+func (s *Server) pinList(c *call) {
+	var req struct {
+		ID string `json:"list_id"`
+	}
+	if !c.decode(&req) {
+		return
+	} else if s.users[c.args[0]] == nil {
+		c.invalid("The user " + c.args[0] + " does not exist")
+		return
+	} else if s.lists[req.ID] == nil {
+		c.invalid("The list " + req.ID + " does not exist")
+		return
+	}
+	s.linkLocked(relPin, c.args[0], req.ID)
+	c.result("pinned", true)
+}
+
+func (s *Server) unpinList(c *call) {
+	s.unlinkLocked(relPin, c.args[0], c.args[1])
+	c.result("pinned", false)
+}
+
+// Lists
+
+func (s *Server) createList(c *call) {
+	if !s.checkMe(c) {
+		return
+	}
+	var req struct {
+		Name    string `json:"name"`
+		Desc    string `json:"description"`
+		Private bool   `json:"private"`
+	}
+	if !c.decode(&req) {
+		return
+	} else if req.Name == "" {
+		c.invalid("The list name must not be empty")
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	l := &types.List{
+		ID:          s.newIDLocked(),
+		Name:        req.Name,
+		Description: req.Desc,
+		Private:     req.Private,
+		OwnerID:     s.me,
+		CreatedAt:   &now,
+	}
+	s.lists[l.ID] = l
+	c.reply(map[string]interface{}{
+		"data": map[string]string{"id": l.ID, "name": l.Name},
+	})
+}
+
+func (s *Server) lookupList(c *call) {
+	if s.checkList(c) {
+		r := s.newResponse(c)
+		r.sendOne(r.list(s.lists[c.args[0]]))
+	}
+}
+
+func (s *Server) updateList(c *call) {
+	var req struct {
+		Name    *string `json:"name"`
+		Desc    *string `json:"description"`
+		Private *bool   `json:"private"`
+	}
+	l := s.lists[c.args[0]]
+	if l == nil {
+		c.invalid("The list " + c.args[0] + " does not exist")
+		return
+	} else if !c.decode(&req) {
+		return
+	}
+	if req.Name != nil {
+		l.Name = *req.Name
+	}
+	if req.Desc != nil {
+		l.Description = *req.Desc
+	}
+	if req.Private != nil {
+		l.Private = *req.Private
+	}
+	c.result("updated", true)
+}
+
+func (s *Server) deleteList(c *call) {
+	id := c.args[0]
+	if s.lists[id] == nil {
+		c.invalid("The list " + id + " does not exist")
+		return
+	}
+	delete(s.lists, id)
+	s.dropLocked(id)
+	c.result("deleted", true)
+}
+
+func (s *Server) listMembers(c *call) {
+	if s.checkList(c) {
+		s.sendUsers(c, s.outLocked(relMember, c.args[0]), userPages)
+	}
+}
+
+func (s *Server) listFollowers(c *call) {
+	if s.checkList(c) {
+		s.sendUsers(c, s.inLocked(relListFollow, c.args[0]), userPages)
+	}
+}
+
+func (s *Server) listTweets(c *call) {
+	if !s.checkList(c) {
+		return
+	}
+	members := make(map[string]bool)
+	for _, id := range s.outLocked(relMember, c.args[0]) {
+		members[id] = true
+	}
+	s.sendTweets(c, s.timelineLocked(func(t *types.Tweet) bool {
+		return members[t.AuthorID]
+	}), tweetPages)
+}
+
+func (s *Server) addMember(c *call) {
+	var req struct {
+		ID string `json:"user_id"`
+	}
+	if !c.decode(&req) {
+		return
+	} else if s.lists[c.args[0]] == nil {
+		c.invalid("The list " + c.args[0] + " does not exist")
+		return
+	} else if s.users[req.ID] == nil {
+		c.invalid("The user " + req.ID + " does not exist")
+		return
+	}
+	s.linkLocked(relMember, c.args[0], req.ID)
+	c.result("is_member", true)
+}
+
+func (s *Server) removeMember(c *call) {
+	s.unlinkLocked(relMember, c.args[0], c.args[1])
+	c.result("is_member", false)
+}
+
+// parseMentions returns the @-mentions in text.
+func parseMentions(text string) []*types.Mention {
+	var out []*types.Mention
+	rs := []rune(text)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '@' || (i > 0 && isNameRune(rs[i-1])) {
+			continue
+		}
+		j := i + 1
+		for j < len(rs) && isNameRune(rs[j]) {
+			j++
+		}
+		if j > i+1 {
+			out = append(out, &types.Mention{
+				Span:     types.Span{Start: i, End: j},
+				Username: string(rs[i+1 : j]),
+			})
+		}
+		i = j - 1
+	}
+	return out
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || (r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+}
+
+// idLess reports whether numeric ID a is less than numeric ID b.
+func idLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
@@ -0,0 +1,323 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twittertest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nankys/twitter/types"
+)
+
+// Default fields for each object type, reported whether or not they were
+// requested.
+var (
+	defaultTweetFields = []string{"id", "text"}
+	defaultUserFields  = []string{"id", "name", "username"}
+	defaultListFields  = []string{"id", "name"}
+	defaultMediaFields = []string{"media_key", "type"}
+	defaultPollFields  = []string{"id", "options"}
+	defaultPlaceFields = []string{"id", "full_name"}
+)
+
+// expansionFields maps each expansion to the field of the primary object that
+// it expands. Requesting an expansion implies a request for its field.
+var expansionFields = map[string]string{
+	"author_id":                      "author_id",
+	"in_reply_to_user_id":            "in_reply_to_user_id",
+	"referenced_tweets.id":           "referenced_tweets",
+	"referenced_tweets.id.author_id": "referenced_tweets",
+	"attachments.media_keys":         "attachments",
+	"attachments.poll_ids":           "attachments",
+	"geo.place_id":                   "geo",
+	"entities.mentions.username":     "entities",
+	"pinned_tweet_id":                "pinned_tweet_id",
+	"owner_id":                       "owner_id",
+}
+
+// A response accumulates the data, includes, and errors of a reply to a
+// single call.
+type response struct {
+	s    *Server
+	c    *call
+	exp  map[string]bool // requested expansions
+	seen map[string]bool // included objects, by kind and ID
+
+	users, tweets, media, polls, places []json.RawMessage
+
+	errors []map[string]string
+}
+
+func (s *Server) newResponse(c *call) *response {
+	r := &response{
+		s:    s,
+		c:    c,
+		exp:  make(map[string]bool),
+		seen: make(map[string]bool),
+	}
+	for _, e := range c.list("expansions") {
+		r.exp[e] = true
+	}
+	return r
+}
+
+// render encodes v as a JSON object containing only the given default fields
+// and the fields requested by the named parameter.
+func (r *response) render(v interface{}, defaults []string, param string) json.RawMessage {
+	return r.renderFields(v, defaults, param, nil)
+}
+
+// renderPrimary is as render, but also includes the fields implied by the
+// requested expansions. It is used for the primary objects of a response.
+func (r *response) renderPrimary(v interface{}, defaults []string, param string) json.RawMessage {
+	var implied []string
+	for exp := range r.exp {
+		if f, ok := expansionFields[exp]; ok {
+			implied = append(implied, f)
+		}
+	}
+	return r.renderFields(v, defaults, param, implied)
+}
+
+func (r *response) renderFields(v interface{}, defaults []string, param string, implied []string) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("encoding %T: %v", v, err))
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		panic(fmt.Sprintf("decoding %T: %v", v, err))
+	}
+	out := make(map[string]json.RawMessage)
+	for _, fields := range [][]string{defaults, r.c.list(param), implied} {
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				out[f] = v
+			}
+		}
+	}
+	enc, _ := json.Marshal(out)
+	return enc
+}
+
+// tweet renders t as a primary object of the response, and includes the
+// objects for any expansions it requests.
+func (r *response) tweet(t *types.Tweet) json.RawMessage {
+	if r.exp["author_id"] && t.AuthorID != "" {
+		r.includeUser(t.AuthorID, "author_id")
+	}
+	if r.exp["in_reply_to_user_id"] && t.InReplyTo != "" {
+		r.includeUser(t.InReplyTo, "in_reply_to_user_id")
+	}
+	if r.exp["entities.mentions.username"] && t.Entities != nil {
+		for _, m := range t.Entities.Mentions {
+			if u := r.s.userByNameLocked(m.Username); u != nil {
+				r.includeUser(u.ID, "entities.mentions.username")
+			} else {
+				r.notFound("user", "entities.mentions.username", m.Username)
+			}
+		}
+	}
+	if r.exp["attachments.media_keys"] {
+		for _, key := range t.Attachments["media_keys"] {
+			if m, ok := r.s.media[key]; !ok {
+				r.notFound("media", "attachments.media_keys", key)
+			} else if r.see("media", key) {
+				r.media = append(r.media, r.render(m, defaultMediaFields, "media.fields"))
+			}
+		}
+	}
+	if r.exp["attachments.poll_ids"] {
+		for _, id := range t.Attachments["poll_ids"] {
+			if p, ok := r.s.polls[id]; !ok {
+				r.notFound("poll", "attachments.poll_ids", id)
+			} else if r.see("poll", id) {
+				r.polls = append(r.polls, r.render(p, defaultPollFields, "poll.fields"))
+			}
+		}
+	}
+	if r.exp["geo.place_id"] && t.Location != nil && t.Location.PlaceID != "" {
+		id := t.Location.PlaceID
+		if p, ok := r.s.places[id]; !ok {
+			r.notFound("place", "geo.place_id", id)
+		} else if r.see("place", id) {
+			r.places = append(r.places, r.render(p, defaultPlaceFields, "place.fields"))
+		}
+	}
+	for _, ref := range t.Referenced {
+		rt, ok := r.s.tweets[ref.ID]
+		if r.exp["referenced_tweets.id"] {
+			r.includeTweet(ref.ID, "referenced_tweets.id")
+		}
+		if ok && r.exp["referenced_tweets.id.author_id"] && rt.AuthorID != "" {
+			r.includeUser(rt.AuthorID, "referenced_tweets.id.author_id")
+		}
+	}
+	return r.renderPrimary(t, defaultTweetFields, "tweet.fields")
+}
+
+// user renders u as a primary object of the response, and includes the
+// objects for any expansions it requests.
+func (r *response) user(u *types.User) json.RawMessage {
+	if r.exp["pinned_tweet_id"] && u.PinnedTweetID != "" {
+		r.includeTweet(u.PinnedTweetID, "pinned_tweet_id")
+	}
+	return r.renderPrimary(u, defaultUserFields, "user.fields")
+}
+
+// list renders l as a primary object of the response, and includes the
+// objects for any expansions it requests.
+func (r *response) list(l *types.List) json.RawMessage {
+	if r.exp["owner_id"] && l.OwnerID != "" {
+		r.includeUser(l.OwnerID, "owner_id")
+	}
+	return r.renderPrimary(r.s.listLocked(l), defaultListFields, "list.fields")
+}
+
+func (r *response) includeUser(id, param string) {
+	if u, ok := r.s.users[id]; !ok {
+		r.notFound("user", param, id)
+	} else if r.see("user", id) {
+		r.users = append(r.users, r.render(u, defaultUserFields, "user.fields"))
+	}
+}
+
+func (r *response) includeTweet(id, param string) {
+	if t, ok := r.s.tweets[id]; !ok {
+		r.notFound("tweet", param, id)
+	} else if r.see("tweet", id) {
+		r.tweets = append(r.tweets, r.render(t, defaultTweetFields, "tweet.fields"))
+	}
+}
+
+// see records that the object of the given kind and ID has been included,
+// and reports whether it was not already.
+func (r *response) see(kind, id string) bool {
+	key := kind + ":" + id
+	if r.seen[key] {
+		return false
+	}
+	r.seen[key] = true
+	return true
+}
+
+// notFound records an error for an object that could not be found.
+func (r *response) notFound(resource, param, value string) {
+	r.errors = append(r.errors, map[string]string{
+		"value":         value,
+		"detail":        fmt.Sprintf("Could not find %s with %s: [%s].", resource, param, value),
+		"title":         "Not Found Error",
+		"resource_type": resource,
+		"parameter":     param,
+		"resource_id":   value,
+		"type":          problemBase + "resource-not-found",
+	})
+}
+
+// send writes the response with the given data and metadata. Empty data and
+// nil metadata are omitted.
+func (r *response) send(data []json.RawMessage, meta map[string]interface{}) {
+	r.sendData(data, len(data) != 0, meta)
+}
+
+// sendOne writes a response whose data are a single object, or no data if
+// obj == nil.
+func (r *response) sendOne(obj json.RawMessage) {
+	r.sendData(obj, obj != nil, nil)
+}
+
+func (r *response) sendData(data interface{}, hasData bool, meta map[string]interface{}) {
+	r.c.reply(r.body(data, hasData, meta))
+}
+
+// body returns the JSON body of a response with the given data and metadata.
+func (r *response) body(data interface{}, hasData bool, meta map[string]interface{}) map[string]interface{} {
+	body := make(map[string]interface{})
+	if hasData {
+		body["data"] = data
+	}
+	inc := make(map[string][]json.RawMessage)
+	for kind, objs := range map[string][]json.RawMessage{
+		"users": r.users, "tweets": r.tweets, "media": r.media, "polls": r.polls, "places": r.places,
+	} {
+		if len(objs) != 0 {
+			inc[kind] = objs
+		}
+	}
+	if len(inc) != 0 {
+		body["includes"] = inc
+	}
+	if len(r.errors) != 0 {
+		body["errors"] = r.errors
+	}
+	if meta != nil {
+		body["meta"] = meta
+	}
+	return body
+}
+
+// A pageSpec gives the pagination parameters of an endpoint.
+type pageSpec struct {
+	param         string // the name of the page token parameter
+	def, min, max int    // default, minimum, and maximum page sizes
+}
+
+// page selects a page of ids according to the max_results and page token
+// parameters of the call, and returns the page with its metadata. It reports
+// false, after writing an error response, if the parameters are invalid.
+func (c *call) page(ids []string, spec pageSpec) ([]string, map[string]interface{}, bool) {
+	size := spec.def
+	if v := c.param("max_results"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < spec.min || n > spec.max {
+			c.invalid(fmt.Sprintf("The `max_results` query parameter value [%s] is not between %d and %d",
+				v, spec.min, spec.max))
+			return nil, nil, false
+		}
+		size = n
+	}
+	var offset int
+	if tok := c.param(spec.param); tok != "" {
+		n, ok := decodeToken(tok)
+		if !ok || n > len(ids) {
+			c.invalid(fmt.Sprintf("The `%s` query parameter value [%s] is not valid", spec.param, tok))
+			return nil, nil, false
+		}
+		offset = n
+	}
+	end := offset + size
+	if end > len(ids) {
+		end = len(ids)
+	}
+	meta := map[string]interface{}{"result_count": end - offset}
+	if end < len(ids) {
+		meta["next_token"] = encodeToken(end)
+	}
+	if offset > 0 {
+		prev := offset - size
+		if prev < 0 {
+			prev = 0
+		}
+		meta["previous_token"] = encodeToken(prev)
+	}
+	return ids[offset:end], meta, true
+}
+
+const tokenPrefix = "twittertest:"
+
+func encodeToken(offset int) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(
+		[]byte(tokenPrefix+strconv.Itoa(offset))), "=")
+}
+
+func decodeToken(tok string) (int, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(tok)
+	if err != nil || !strings.HasPrefix(string(data), tokenPrefix) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(string(data), tokenPrefix))
+	return n, err == nil && n >= 0
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twittertest
+
+import (
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/types"
+)
+
+// matchLocked reports whether t matches m, resolving the objects that t
+// refers to from the state of the server.
+func (s *Server) matchLocked(m *query.Matcher, t *types.Tweet) bool {
+	return m.Match(t, s.includesLocked(t))
+}
+
+// includesLocked returns the objects referenced by t: its author, the user it
+// replies to, the tweets it references and their authors, and its media.
+func (s *Server) includesLocked(t *types.Tweet) *query.Includes {
+	inc := new(query.Includes)
+	addUser := func(id string) {
+		if u, ok := s.users[id]; ok {
+			inc.Users = append(inc.Users, u)
+		}
+	}
+	addUser(t.AuthorID)
+	addUser(t.InReplyTo)
+	for _, ref := range t.Referenced {
+		if rt, ok := s.tweets[ref.ID]; ok {
+			inc.Tweets = append(inc.Tweets, rt)
+			addUser(rt.AuthorID)
+		}
+	}
+	for _, key := range t.Attachments["media_keys"] {
+		if m, ok := s.media[key]; ok {
+			inc.Media = append(inc.Media, m)
+		}
+	}
+	return inc
+}
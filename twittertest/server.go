@@ -0,0 +1,550 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+// Package twittertest provides an in-memory fake of the Twitter API v2 for
+// use in tests.
+//
+// # Usage
+//
+// Construct a Server with the data your test needs, and use its client to
+// issue queries as you would against the production API:
+//
+//	srv := twittertest.NewServer(&twittertest.Seed{
+//	   Me:    "1",
+//	   Users: []*types.User{{ID: "1", Username: "alice"}, {ID: "2", Username: "bob"}},
+//	   Follows: map[string][]string{"1": {"2"}},
+//	})
+//	defer srv.Close()
+//
+//	rsp, err := users.FollowersOf("2", nil).Invoke(ctx, srv.Client())
+//
+// The server implements the v2 endpoints wrapped by the tweets, users, lists
+// and edit packages: lookup, timelines, recent search, follows, likes,
+// bookmarks, retweets, blocks, mutes, and list management. Edits change the
+// state of the server, so their effects are visible to subsequent queries.
+//
+// # Fidelity
+//
+// Responses contain only the default fields of each object, plus those
+// requested with field parameters such as "tweet.fields". Expansions are
+// resolved into the includes of the response, and references that cannot be
+// resolved are reported as errors, as the production API does. Results are
+// paginated using max_results and opaque page tokens.
+//
+// # Filtered Stream
+//
+// The server also implements the filtered stream. Rules are added and removed
+// with the rules package, and validated as the production API does, subject to
+// the rule limits given in the seed; an update with an invalid rule adds none
+// of its rules. Tweets passed to Inject are delivered to each open stream if
+// they match at least one active rule, tagged with the matching rules:
+//
+//	srv.Inject(&types.Tweet{Text: "look at my cat", AuthorID: "1"})
+//
+// Tests can script the behavior of the stream with KeepAlive, StreamError,
+// OperationalDisconnect, Disconnect, and RefuseStreams, and synchronize with
+// connections using WaitStreams.
+//
+// Search queries and stream rules are checked with query.ValidateString at
+// the Elevated access level, and evaluated with a query.Matcher, so they
+// support the subset of the query syntax described there. A rule that fails
+// validation or uses other operators is reported as invalid.
+//
+// The server does not check authorization. Tweets and lists created through
+// the server are attributed to the user given as Me in the seed.
+package twittertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/creachadair/jhttp"
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/types"
+)
+
+// A Seed describes the initial state of a Server. Relationships are given as
+// maps from the ID of the subject to the IDs of its objects, in the order the
+// relationships were formed.
+type Seed struct {
+	Me string // the ID of the authenticated user
+
+	Users  []*types.User
+	Tweets []*types.Tweet
+	Lists  []*types.List
+	Media  []*types.Media
+	Polls  []*types.Poll
+	Places []*types.Place
+
+	Follows map[string][]string // user ID → followed user IDs
+	Blocks  map[string][]string // user ID → blocked user IDs
+	Mutes   map[string][]string // user ID → muted user IDs
+
+	Likes     map[string][]string // user ID → liked tweet IDs
+	Bookmarks map[string][]string // user ID → bookmarked tweet IDs
+	Retweets  map[string][]string // user ID → retweeted tweet IDs
+
+	Members     map[string][]string // list ID → member user IDs
+	ListFollows map[string][]string // user ID → followed list IDs
+	Pins        map[string][]string // user ID → pinned list IDs
+
+	// Limits on the number and length of filtered stream rules, and on the
+	// number of rules in each update request. If zero, DefaultMaxRules,
+	// DefaultMaxRuleLength, and DefaultMaxRuleBatch are used.
+	MaxRules      int
+	MaxRuleLength int
+	MaxRuleBatch  int
+}
+
+// Relationship kinds, used as keys for edges.
+const (
+	relFollow     = "follow"
+	relBlock      = "block"
+	relMute       = "mute"
+	relLike       = "like"
+	relBookmark   = "bookmark"
+	relRetweet    = "retweet"
+	relMember     = "member"
+	relListFollow = "list_follow"
+	relPin        = "pin"
+)
+
+// A Server is an in-memory fake of the Twitter API v2. A Server is safe for
+// concurrent use.
+type Server struct {
+	// The base URL of the server, for use as the BaseURL of a client.
+	URL string
+
+	hs *httptest.Server
+
+	mu     sync.Mutex
+	me     string
+	nextID int64
+	users  map[string]*types.User
+	tweets map[string]*types.Tweet
+	lists  map[string]*types.List
+	media  map[string]*types.Media
+	polls  map[string]*types.Poll
+	places map[string]*types.Place
+	hidden map[string]bool // tweet IDs whose replies are hidden
+	edges  []edge
+
+	rules          []*streamRule
+	maxRules       int
+	maxRuleLength  int
+	maxRuleBatch   int
+	streams        map[*subscriber]bool
+	streamsChanged chan struct{} // closed when streams changes
+	refuse         int           // the number of stream connections to refuse
+	refuseStatus   int           // the HTTP status for refused connections
+	closed         bool
+}
+
+// An edge records a relationship of the given kind between two objects.
+type edge struct {
+	kind, from, to string
+}
+
+// NewServer constructs and starts a new Server populated with the contents of
+// seed, which may be nil. The caller must Close the server when it is no
+// longer needed.
+func NewServer(seed *Seed) *Server {
+	s := &Server{
+		nextID: 1500000000000000000,
+		users:  make(map[string]*types.User),
+		tweets: make(map[string]*types.Tweet),
+		lists:  make(map[string]*types.List),
+		media:  make(map[string]*types.Media),
+		polls:  make(map[string]*types.Poll),
+		places: make(map[string]*types.Place),
+		hidden: make(map[string]bool),
+
+		maxRules:       DefaultMaxRules,
+		maxRuleLength:  DefaultMaxRuleLength,
+		maxRuleBatch:   DefaultMaxRuleBatch,
+		streams:        make(map[*subscriber]bool),
+		streamsChanged: make(chan struct{}),
+	}
+	if seed != nil {
+		s.Seed(seed)
+	}
+	s.hs = httptest.NewServer(s)
+	s.URL = s.hs.URL
+	return s
+}
+
+// Close shuts down the server and blocks until all outstanding requests on
+// the server have completed. Open streams are disconnected.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for sub := range s.streams {
+		s.closeLocked(sub)
+	}
+	s.mu.Unlock()
+	s.hs.Close()
+}
+
+// Client returns a new client for the API served by s.
+func (s *Server) Client() *twitter.Client {
+	return twitter.NewClient(&jhttp.Client{BaseURL: s.URL})
+}
+
+// Seed adds the contents of seed to the state of s. Objects are copied into
+// the server, except that objects without an ID are assigned a new one, which
+// is written back to the seed. If seed.Me is set, it replaces the
+// authenticated user.
+func (s *Server) Seed(seed *Seed) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seed.Me != "" {
+		s.me = seed.Me
+	}
+	if seed.MaxRules > 0 {
+		s.maxRules = seed.MaxRules
+	}
+	if seed.MaxRuleLength > 0 {
+		s.maxRuleLength = seed.MaxRuleLength
+	}
+	if seed.MaxRuleBatch > 0 {
+		s.maxRuleBatch = seed.MaxRuleBatch
+	}
+	for _, u := range seed.Users {
+		if u.ID == "" {
+			u.ID = s.newIDLocked()
+		}
+		cp := *u
+		s.users[u.ID] = &cp
+	}
+	for _, t := range seed.Tweets {
+		if t.ID == "" {
+			t.ID = s.newIDLocked()
+		}
+		cp := *t
+		s.tweets[t.ID] = &cp
+	}
+	for _, l := range seed.Lists {
+		if l.ID == "" {
+			l.ID = s.newIDLocked()
+		}
+		cp := *l
+		s.lists[l.ID] = &cp
+	}
+	for _, m := range seed.Media {
+		if m.Key == "" {
+			m.Key = "3_" + s.newIDLocked()
+		}
+		cp := *m
+		s.media[m.Key] = &cp
+	}
+	for _, p := range seed.Polls {
+		if p.ID == "" {
+			p.ID = s.newIDLocked()
+		}
+		cp := *p
+		s.polls[p.ID] = &cp
+	}
+	for _, p := range seed.Places {
+		cp := *p
+		s.places[p.ID] = &cp
+	}
+	for _, r := range []struct {
+		kind string
+		m    map[string][]string
+	}{
+		{relFollow, seed.Follows}, {relBlock, seed.Blocks}, {relMute, seed.Mutes},
+		{relLike, seed.Likes}, {relBookmark, seed.Bookmarks}, {relRetweet, seed.Retweets},
+		{relMember, seed.Members}, {relListFollow, seed.ListFollows}, {relPin, seed.Pins},
+	} {
+		froms := make([]string, 0, len(r.m))
+		for from := range r.m {
+			froms = append(froms, from)
+		}
+		sort.Strings(froms)
+		for _, from := range froms {
+			for _, to := range r.m[from] {
+				s.linkLocked(r.kind, from, to)
+			}
+		}
+	}
+}
+
+// Tweet returns a copy of the tweet with the given ID, or nil if there is no
+// such tweet.
+func (s *Server) Tweet(id string) *types.Tweet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tweets[id]; ok {
+		cp := *t
+		return &cp
+	}
+	return nil
+}
+
+// User returns a copy of the user with the given ID, or nil if there is no
+// such user.
+func (s *Server) User(id string) *types.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		cp := *u
+		return &cp
+	}
+	return nil
+}
+
+// List returns a copy of the list with the given ID, or nil if there is no
+// such list.
+func (s *Server) List(id string) *types.List {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.lists[id]; ok {
+		return s.listLocked(l)
+	}
+	return nil
+}
+
+func (s *Server) newIDLocked() string {
+	for {
+		s.nextID++
+		id := strconv.FormatInt(s.nextID, 10)
+		if s.users[id] == nil && s.tweets[id] == nil && s.lists[id] == nil && s.polls[id] == nil {
+			return id
+		}
+	}
+}
+
+// linkLocked adds an edge of the given kind, if it is not already present.
+// It reports whether the edge was added.
+func (s *Server) linkLocked(kind, from, to string) bool {
+	if s.hasLocked(kind, from, to) {
+		return false
+	}
+	s.edges = append(s.edges, edge{kind: kind, from: from, to: to})
+	return true
+}
+
+// unlinkLocked removes an edge of the given kind, if present.
+func (s *Server) unlinkLocked(kind, from, to string) {
+	for i, e := range s.edges {
+		if e == (edge{kind: kind, from: from, to: to}) {
+			s.edges = append(s.edges[:i], s.edges[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) hasLocked(kind, from, to string) bool {
+	for _, e := range s.edges {
+		if e == (edge{kind: kind, from: from, to: to}) {
+			return true
+		}
+	}
+	return false
+}
+
+// outLocked returns the targets of edges of the given kind from the given
+// subject, most recent first.
+func (s *Server) outLocked(kind, from string) []string {
+	var out []string
+	for i := len(s.edges) - 1; i >= 0; i-- {
+		if e := s.edges[i]; e.kind == kind && e.from == from {
+			out = append(out, e.to)
+		}
+	}
+	return out
+}
+
+// inLocked returns the subjects of edges of the given kind to the given
+// target, most recent first.
+func (s *Server) inLocked(kind, to string) []string {
+	var out []string
+	for i := len(s.edges) - 1; i >= 0; i-- {
+		if e := s.edges[i]; e.kind == kind && e.to == to {
+			out = append(out, e.from)
+		}
+	}
+	return out
+}
+
+// dropLocked removes all edges to or from the given ID.
+func (s *Server) dropLocked(id string) {
+	keep := s.edges[:0]
+	for _, e := range s.edges {
+		if e.from != id && e.to != id {
+			keep = append(keep, e)
+		}
+	}
+	s.edges = keep
+}
+
+// listLocked returns a copy of l with its member and follower counts updated
+// from the current state.
+func (s *Server) listLocked(l *types.List) *types.List {
+	cp := *l
+	cp.Members = len(s.outLocked(relMember, l.ID))
+	cp.Followers = len(s.inLocked(relListFollow, l.ID))
+	return &cp
+}
+
+// userByNameLocked returns the user with the given username, ignoring case,
+// or nil.
+func (s *Server) userByNameLocked(name string) *types.User {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, name) {
+			return u
+		}
+	}
+	return nil
+}
+
+// timelineLocked returns the IDs of the tweets selected by keep, newest
+// first.
+func (s *Server) timelineLocked(keep func(*types.Tweet) bool) []string {
+	var ids []string
+	for id, t := range s.tweets {
+		if keep(t) {
+			ids = append(ids, id)
+		}
+	}
+	sortNewestFirst(ids)
+	return ids
+}
+
+// sortNewestFirst sorts numeric IDs in decreasing order.
+func sortNewestFirst(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i], ids[j]
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a > b
+	})
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	if !strings.HasPrefix(path, "2/") {
+		writeProblem(w, http.StatusNotFound, "Not Found", "about:blank", "unknown API version")
+		return
+	}
+	segs := strings.Split(strings.TrimPrefix(path, "2/"), "/")
+	for _, rt := range routes {
+		args, ok := rt.match(req.Method, segs)
+		if !ok {
+			continue
+		}
+		c := &call{w: w, req: req, args: args, query: req.URL.Query()}
+		func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			rt.handle(s, c)
+		}()
+		if c.then != nil {
+			c.then()
+		}
+		return
+	}
+	writeProblem(w, http.StatusNotFound, "Not Found", "about:blank",
+		"no route for "+req.Method+" "+req.URL.Path)
+}
+
+// A route maps a method and path pattern to a handler. Pattern segments
+// beginning with ":" match any value, which is captured as an argument.
+type route struct {
+	method  string
+	pattern string
+	handle  func(*Server, *call)
+}
+
+func (r route) match(method string, segs []string) ([]string, bool) {
+	if method != r.method {
+		return nil, false
+	}
+	pat := strings.Split(r.pattern, "/")
+	if len(pat) != len(segs) {
+		return nil, false
+	}
+	var args []string
+	for i, p := range pat {
+		if strings.HasPrefix(p, ":") {
+			args = append(args, segs[i])
+		} else if p != segs[i] {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// A call carries the state of a single request to the server.
+type call struct {
+	w     http.ResponseWriter
+	req   *http.Request
+	args  []string
+	query map[string][]string
+
+	// If set, then is called after the handler returns and the server lock
+	// is released. Long-running handlers, such as streams, use this.
+	then func()
+}
+
+// param returns the value of the named query parameter, or "".
+func (c *call) param(name string) string {
+	if vs := c.query[name]; len(vs) != 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// list returns the comma-separated values of the named query parameter.
+func (c *call) list(name string) []string {
+	v := c.param(name)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// decode decodes the JSON request body into v. It reports false, after
+// writing an error response, if this fails.
+func (c *call) decode(v interface{}) bool {
+	if err := json.NewDecoder(c.req.Body).Decode(v); err != nil {
+		c.invalid("invalid request body: " + err.Error())
+		return false
+	}
+	return true
+}
+
+// reply writes a successful response with the given body.
+func (c *call) reply(body interface{}) {
+	c.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(c.w).Encode(body)
+}
+
+// result writes a successful edit response reporting the given tag.
+func (c *call) result(tag string, value bool) {
+	c.reply(map[string]interface{}{"data": map[string]bool{tag: value}})
+}
+
+// invalid writes an invalid-request response with the given detail.
+func (c *call) invalid(detail string) {
+	writeProblem(c.w, http.StatusBadRequest, "Invalid Request", problemBase+"invalid-request", detail)
+}
+
+const problemBase = "https://api.twitter.com/2/problems/"
+
+func writeProblem(w http.ResponseWriter, status int, title, typeURL, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"title":  title,
+		"type":   typeURL,
+		"detail": detail,
+		"status": status,
+	})
+}
@@ -0,0 +1,232 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twittertest_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/edit"
+	"github.com/nankys/twitter/lists"
+	"github.com/nankys/twitter/tweets"
+	"github.com/nankys/twitter/twittertest"
+	"github.com/nankys/twitter/types"
+	"github.com/nankys/twitter/users"
+)
+
+func newServer(t *testing.T) *twittertest.Server {
+	t.Helper()
+	seed := &twittertest.Seed{
+		Me: "1",
+		Users: []*types.User{
+			{ID: "1", Name: "Alice", Username: "alice", Description: "I am Alice"},
+			{ID: "2", Name: "Bob", Username: "bob", PinnedTweetID: "101"},
+			{ID: "3", Name: "Carol", Username: "carol", Protected: true},
+		},
+		Tweets: []*types.Tweet{
+			{ID: "100", Text: "hello world", AuthorID: "1"},
+			{ID: "101", Text: "cats are great", AuthorID: "2",
+				Attachments: types.Attachments{"media_keys": {"3_1"}}},
+			{ID: "102", Text: "@alice look at this", AuthorID: "2",
+				Referenced: []*types.Ref{{Type: "quoted", ID: "100"}},
+				Entities:   &types.Entities{Mentions: []*types.Mention{{Username: "alice"}}}},
+		},
+		Media:   []*types.Media{{Key: "3_1", Type: "photo", Width: 640}},
+		Lists:   []*types.List{{ID: "500", Name: "friends", OwnerID: "1"}},
+		Follows: map[string][]string{"1": {"2"}, "3": {"2"}},
+		Likes:   map[string][]string{"1": {"101", "102"}},
+		Members: map[string][]string{"500": {"2"}},
+	}
+	// Add enough followers of Alice to require pagination.
+	for i := 10; i < 35; i++ {
+		id := strconv.Itoa(i)
+		seed.Users = append(seed.Users, &types.User{ID: id, Username: "user" + id})
+		seed.Follows[id] = []string{"1"}
+	}
+	srv := twittertest.NewServer(seed)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLookup(t *testing.T) {
+	srv := newServer(t)
+	cli := srv.Client()
+	ctx := context.Background()
+
+	rsp, err := tweets.Lookup("102", &tweets.LookupOpts{
+		More: []string{"404"},
+		Optional: []types.Fields{
+			types.TweetFields{AuthorID: true},
+			types.Expansions{AuthorID: true, ReferencedTweetID: true, ReferencedAuthorID: true},
+		},
+	}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if r := rsp.Results["404"]; r == nil || r.Status() != types.StatusNotFound {
+		t.Errorf("Result for 404: got %+v, want not found", r)
+	}
+	hs, err := rsp.Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate failed: %v", err)
+	}
+	h := hs[0]
+	if h.Author == nil || h.Author.Username != "bob" {
+		t.Errorf("Author: got %+v, want bob", h.Author)
+	}
+	if q := h.Ref("quoted"); q == nil || q.Text != "hello world" || q.Author == nil || q.Author.Username != "alice" {
+		t.Errorf("Quoted: got %+v, want hello world by alice", q)
+	}
+	if h.Entities != nil {
+		t.Errorf("Entities: got %+v, want none (not requested)", h.Entities)
+	}
+
+	urs, err := users.LookupByName("ALICE", &users.LookupOpts{
+		Optional: []types.Fields{types.UserFields{Description: true}},
+	}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("LookupByName failed: %v", err)
+	}
+	if len(urs.Users) != 1 || urs.Users[0].Description != "I am Alice" {
+		t.Errorf("LookupByName: got %+v, want alice with description", urs.Users)
+	}
+
+	// A missing expansion is reported as an error.
+	urs, err = users.Lookup("2", &users.LookupOpts{
+		Optional: []types.Fields{types.Expansions{PinnedTweetID: true}},
+	}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if pinned, err := urs.IncludedTweets(); err != nil || len(pinned) != 1 || pinned[0].ID != "101" {
+		t.Errorf("Pinned tweet: got %+v, %v; want 101", pinned, err)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	srv := newServer(t)
+	q := users.FollowersOf("1", &users.ListOpts{MaxResults: 10})
+	var got []string
+	var pages int
+	if err := twitter.NewPager(q, nil).EachPage(context.Background(), srv.Client(), func(p *twitter.Page) error {
+		pages++
+		for _, u := range p.Items {
+			got = append(got, u.(*types.User).ID)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("EachPage failed: %v", err)
+	}
+	if pages != 3 || len(got) != 25 {
+		t.Errorf("Got %d followers in %d pages, want 25 in 3", len(got), pages)
+	}
+	if got[0] != "34" || got[24] != "10" {
+		t.Errorf("Followers: got %s..%s, want most recent first", got[0], got[24])
+	}
+
+	_, err := users.FollowersOf("1", &users.ListOpts{PageToken: "bogus"}).Invoke(context.Background(), srv.Client())
+	var aerr *twitter.APIError
+	if !errors.As(err, &aerr) || aerr.Status != 400 {
+		t.Errorf("Bogus page token: got %v, want invalid request", err)
+	}
+}
+
+func TestEdits(t *testing.T) {
+	srv := newServer(t)
+	cli := srv.Client()
+	ctx := context.Background()
+
+	mustEdit := func(q edit.Query, want bool) {
+		t.Helper()
+		if got, err := q.Invoke(ctx, cli); err != nil {
+			t.Fatalf("Edit %s failed: %v", q.Method, err)
+		} else if got != want {
+			t.Errorf("Edit %s: got %v, want %v", q.Method, got, want)
+		}
+	}
+	userIDs := func(q users.Query) string {
+		t.Helper()
+		rsp, err := q.Invoke(ctx, cli)
+		if err != nil {
+			t.Fatalf("Query %s failed: %v", q.Method, err)
+		}
+		var ids []string
+		for _, u := range rsp.Users {
+			ids = append(ids, u.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	mustEdit(edit.Like("2", "100"), true)
+	if got := userIDs(users.LikersOf("100", nil)); got != "2" {
+		t.Errorf("Likers of 100: got %q, want 2", got)
+	}
+	mustEdit(edit.Follow("1", "3"), false) // pending, since carol is protected
+	mustEdit(edit.Block("2", "1"), true)   // also removes alice following bob
+	if got := userIDs(users.FollowersOf("2", nil)); got != "3" {
+		t.Errorf("Followers of 2: got %q, want 3", got)
+	}
+	mustEdit(edit.Mute("1", "3"), true)
+	mustEdit(edit.Unmute("1", "3"), false)
+	if got := userIDs(users.MutedBy("1", nil)); got != "" {
+		t.Errorf("Muted by 1: got %q, want none", got)
+	}
+
+	// Create a tweet, and find it by search.
+	rsp, err := tweets.Create(tweets.CreateOpts{
+		Text:      "hey @bob, more cats",
+		InReplyTo: "101",
+	}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	id := rsp.Tweets[0].ID
+	if tw := srv.Tweet(id); tw == nil || tw.InReplyTo != "2" || tw.AuthorID != "1" {
+		t.Errorf("Created tweet: got %+v, want reply to bob by alice", tw)
+	}
+	srs, err := tweets.SearchRecent("cats -great", nil).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("SearchRecent failed: %v", err)
+	}
+	if len(srs.Tweets) != 1 || srs.Tweets[0].ID != id {
+		t.Errorf("SearchRecent: got %+v, want %s", srs.Tweets, id)
+	}
+	mrs, err := tweets.MentioningUser("2", nil).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("MentioningUser failed: %v", err)
+	}
+	if len(mrs.Tweets) != 1 || mrs.Tweets[0].ID != id {
+		t.Errorf("Mentions of bob: got %+v, want %s", mrs.Tweets, id)
+	}
+	mustEdit(edit.DeleteTweet(id), true)
+	if srv.Tweet(id) != nil {
+		t.Errorf("Tweet %s still exists after deletion", id)
+	}
+
+	// Lists
+	lrs, err := lists.Create("cats", "people who like cats", false).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Create list failed: %v", err)
+	}
+	lid := lrs.Lists[0].ID
+	if ok, err := lists.AddMember(lid, "2").Invoke(ctx, cli); err != nil || !ok {
+		t.Fatalf("AddMember: got %v, %v; want true", ok, err)
+	}
+	if got := userIDs(lists.Members(lid, nil)); got != "2" {
+		t.Errorf("Members of %s: got %q, want 2", lid, got)
+	}
+	trs, err := lists.Tweets(lid, nil).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("List tweets failed: %v", err)
+	}
+	if len(trs.Tweets) != 2 || trs.Tweets[0].ID != "102" {
+		t.Errorf("List tweets: got %+v, want 102, 101", trs.Tweets)
+	}
+	if l := srv.List(lid); l == nil || l.Members != 1 || l.OwnerID != "1" {
+		t.Errorf("List %s: got %+v, want 1 member owned by 1", lid, l)
+	}
+}
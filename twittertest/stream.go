@@ -0,0 +1,498 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twittertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nankys/twitter/query"
+	"github.com/nankys/twitter/rules"
+	"github.com/nankys/twitter/types"
+)
+
+// Default limits on the rules of a filtered stream, matching the Elevated
+// access level of the production API.
+const (
+	DefaultMaxRules      = 25
+	DefaultMaxRuleLength = 512
+	DefaultMaxRuleBatch  = rules.MaxBatch
+)
+
+// streamBuffer is the number of messages buffered for each open stream. A
+// stream whose buffer is full is disconnected, as the production API does for
+// consumers that do not keep up.
+const streamBuffer = 1024
+
+// keepAlive is the message sent to keep an idle stream open.
+var keepAlive = []byte("\r\n")
+
+// A streamRule is an active filtered stream rule.
+type streamRule struct {
+	rules.Rule
+	m *query.Matcher
+}
+
+// A subscriber is an open connection to the filtered stream.
+type subscriber struct {
+	c    *call
+	msgs chan []byte   // messages to deliver; nil closes the stream
+	drop chan struct{} // closed to disconnect without delivering pending messages
+}
+
+// Rules returns the active filtered stream rules, in order of creation.
+func (s *Server) Rules() []rules.Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]rules.Rule, len(s.rules))
+	for i, r := range s.rules {
+		out[i] = r.Rule
+	}
+	return out
+}
+
+// Inject adds tweets to the server as if they had just been posted, and
+// delivers each to the open filtered streams with at least one matching rule.
+// Tweets without an ID are assigned one, which is written back to the tweet.
+// Inject returns the total number of deliveries.
+func (s *Server) Inject(tweets ...*types.Tweet) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var nd int
+	for _, t := range tweets {
+		if t.ID == "" {
+			t.ID = s.newIDLocked()
+		}
+		cp := *t
+		if cp.CreatedAt == nil {
+			now := time.Now().UTC().Truncate(time.Second)
+			cp.CreatedAt = &now
+		}
+		s.tweets[cp.ID] = &cp
+
+		var matched []map[string]string
+		for _, r := range s.rules {
+			if s.matchLocked(r.m, &cp) {
+				matched = append(matched, map[string]string{"id": r.ID, "tag": r.Tag})
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		for sub := range s.streams {
+			r := s.newResponse(sub.c)
+			body := r.body(r.tweet(&cp), true, nil)
+			body["matching_rules"] = matched
+			s.sendLocked(sub, encodeMessage(body))
+			nd++
+		}
+	}
+	return nd
+}
+
+// KeepAlive sends a keep-alive message to each open filtered stream.
+func (s *Server) KeepAlive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.streams {
+		s.sendLocked(sub, keepAlive)
+	}
+}
+
+// StreamError sends an error message with the given title and detail to each
+// open filtered stream, without closing it.
+func (s *Server) StreamError(title, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := encodeMessage(map[string]interface{}{
+		"errors": []map[string]string{{
+			"title":  title,
+			"detail": detail,
+			"type":   problemBase + "streaming-connection",
+		}},
+	})
+	for sub := range s.streams {
+		s.sendLocked(sub, msg)
+	}
+}
+
+// OperationalDisconnect sends an operational disconnect message with the
+// given detail to each open filtered stream, and then closes it.
+func (s *Server) OperationalDisconnect(detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := encodeMessage(map[string]interface{}{
+		"errors": []map[string]string{{
+			"title":           "operational-disconnect",
+			"disconnect_type": "OperationalDisconnect",
+			"detail":          detail,
+			"type":            problemBase + "operational-disconnect",
+		}},
+	})
+	for sub := range s.streams {
+		s.sendLocked(sub, msg)
+		s.closeLocked(sub)
+	}
+}
+
+// Disconnect closes each open filtered stream without notice, after
+// delivering any messages already sent to it.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.streams {
+		s.closeLocked(sub)
+	}
+}
+
+// RefuseStreams causes the next n connections to the filtered stream to fail
+// with the given HTTP status. A status of 429 reports an exhausted rate limit.
+func (s *Server) RefuseStreams(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse, s.refuseStatus = n, status
+}
+
+// Streams returns the number of open filtered streams.
+func (s *Server) Streams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// WaitStreams blocks until at least n filtered streams are open, or until
+// ctx ends.
+func (s *Server) WaitStreams(ctx context.Context, n int) error {
+	for {
+		s.mu.Lock()
+		ok, ch := len(s.streams) >= n, s.streamsChanged
+		s.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sendLocked queues msg for delivery to sub. If the buffer of sub is full,
+// sub is disconnected.
+func (s *Server) sendLocked(sub *subscriber, msg []byte) {
+	if !s.streams[sub] {
+		return // already closed
+	}
+	select {
+	case sub.msgs <- msg:
+	default:
+		delete(s.streams, sub)
+		close(sub.drop)
+		s.notifyLocked()
+	}
+}
+
+// closeLocked closes sub once its pending messages have been delivered.
+func (s *Server) closeLocked(sub *subscriber) {
+	s.sendLocked(sub, nil)
+	if s.streams[sub] {
+		delete(s.streams, sub)
+		s.notifyLocked()
+	}
+}
+
+// notifyLocked wakes any goroutines waiting for a change in the set of open
+// streams.
+func (s *Server) notifyLocked() {
+	close(s.streamsChanged)
+	s.streamsChanged = make(chan struct{})
+}
+
+func (s *Server) searchStream(c *call) {
+	if s.closed {
+		writeProblem(c.w, http.StatusServiceUnavailable, "Service Unavailable", "about:blank",
+			"the server is shutting down")
+		return
+	}
+	if s.refuse > 0 {
+		s.refuse--
+		if s.refuseStatus == http.StatusTooManyRequests {
+			h := c.w.Header()
+			h.Set("x-rate-limit-limit", "50")
+			h.Set("x-rate-limit-remaining", "0")
+			h.Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(15*time.Minute).Unix(), 10))
+			writeProblem(c.w, s.refuseStatus, "Too Many Requests", "about:blank", "Too Many Requests")
+			return
+		}
+		writeProblem(c.w, s.refuseStatus, http.StatusText(s.refuseStatus), "about:blank",
+			"the stream connection was refused")
+		return
+	}
+	sub := &subscriber{
+		c:    c,
+		msgs: make(chan []byte, streamBuffer),
+		drop: make(chan struct{}),
+	}
+	s.streams[sub] = true
+	s.notifyLocked()
+	c.then = func() { s.serveStream(sub) }
+}
+
+// serveStream delivers the messages for sub until it is closed or its client
+// disconnects. The server lock must not be held.
+func (s *Server) serveStream(sub *subscriber) {
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.streams[sub] {
+			delete(s.streams, sub)
+			s.notifyLocked()
+		}
+	}()
+
+	w := sub.c.w
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flush()
+	for {
+		select {
+		case <-sub.c.req.Context().Done():
+			return
+		case <-sub.drop:
+			return
+		case msg := <-sub.msgs:
+			if msg == nil {
+				return
+			} else if _, err := w.Write(msg); err != nil {
+				return
+			}
+			flush()
+		}
+	}
+}
+
+func (s *Server) getRules(c *call) {
+	want := make(map[string]bool)
+	for _, id := range c.list("ids") {
+		want[id] = true
+	}
+	var data []rules.Rule
+	for _, r := range s.rules {
+		if len(want) == 0 || want[r.ID] {
+			data = append(data, r.Rule)
+		}
+	}
+	body := map[string]interface{}{
+		"meta": map[string]interface{}{"sent": sentTime(), "result_count": len(data)},
+	}
+	if len(data) != 0 {
+		body["data"] = data
+	}
+	c.reply(body)
+}
+
+func (s *Server) updateRules(c *call) {
+	var req struct {
+		Add    []rules.Rule `json:"add"`
+		Delete *struct {
+			IDs []string `json:"ids"`
+		} `json:"delete"`
+	}
+	if !c.decode(&req) {
+		return
+	}
+	dryRun := c.param("dry_run") == "true"
+	n := len(req.Add)
+	if req.Delete != nil {
+		n = len(req.Delete.IDs)
+	}
+	if (req.Add == nil) == (req.Delete == nil) {
+		c.invalid("A request must either add or delete rules, but not both")
+		return
+	} else if n > s.maxRuleBatch {
+		c.invalid(fmt.Sprintf("A request may add or delete at most %d rules", s.maxRuleBatch))
+		return
+	} else if req.Delete != nil {
+		s.deleteRules(c, req.Delete.IDs, dryRun)
+		return
+	}
+
+	var created []*streamRule
+	var errs []map[string]interface{}
+	var err error
+	ruleError := func(value, title, kind, detail string) {
+		errs = append(errs, map[string]interface{}{
+			"value":   value,
+			"title":   title,
+			"details": []string{detail},
+			"type":    problemBase + kind,
+		})
+	}
+	active := len(s.rules)
+	for _, a := range req.Add {
+		var m *query.Matcher
+		if n := len([]rune(a.Value)); n > s.maxRuleLength {
+			ruleError(a.Value, "Invalid Rule", "invalid-rules",
+				fmt.Sprintf("Rule length is %d, which exceeds the limit of %d", n, s.maxRuleLength))
+		} else if msgs := s.queryProblemsLocked(a.Value); len(msgs) != 0 {
+			errs = append(errs, map[string]interface{}{
+				"value":   a.Value,
+				"title":   "Invalid Rule",
+				"details": msgs,
+				"type":    problemBase + "invalid-rules",
+			})
+		} else if m, err = query.CompileString(a.Value); err != nil {
+			ruleError(a.Value, "Invalid Rule", "invalid-rules", err.Error())
+		} else if id := s.ruleIDLocked(a.Value, created); id != "" {
+			errs = append(errs, map[string]interface{}{
+				"value": a.Value,
+				"id":    id,
+				"title": "DuplicateRule",
+				"type":  problemBase + "duplicate-rules",
+			})
+		} else if active+len(created) >= s.maxRules {
+			ruleError(a.Value, "RulesCapExceeded", "rule-cap",
+				fmt.Sprintf("Rule cap of %d rules exceeded", s.maxRules))
+		} else {
+			created = append(created, &streamRule{
+				Rule: rules.Rule{ID: s.newIDLocked(), Value: a.Value, Tag: a.Tag},
+				m:    m,
+			})
+		}
+	}
+
+	// If any rule is invalid, none of the rules are created.
+	summary := map[string]int{
+		"valid":   len(created),
+		"invalid": len(req.Add) - len(created),
+	}
+	if !dryRun {
+		if len(errs) != 0 {
+			created = nil
+		}
+		s.rules = append(s.rules, created...)
+		summary["created"] = len(created)
+		summary["not_created"] = len(req.Add) - len(created)
+	}
+	data := make([]rules.Rule, len(created))
+	for i, r := range created {
+		data[i] = r.Rule
+	}
+	body := map[string]interface{}{
+		"meta": map[string]interface{}{"sent": sentTime(), "summary": summary},
+	}
+	if len(data) != 0 {
+		body["data"] = data
+	}
+	if len(errs) != 0 {
+		body["errors"] = errs
+	}
+	c.reply(body)
+}
+
+// queryProblemsLocked reports the problems that query.ValidateString finds
+// with q, one message per problem. Queries are checked at the Elevated access
+// level, or at the Academic level if the server allows longer rules; the
+// server checks the length of rules separately.
+func (s *Server) queryProblemsLocked(q string) []string {
+	tier := query.Elevated
+	if s.maxRuleLength > tier.MaxLength() {
+		tier = query.Academic
+	}
+	err := query.ValidateString(q, tier)
+	var ps query.Problems
+	if err == nil {
+		return nil
+	} else if !errors.As(err, &ps) {
+		return []string{err.Error()}
+	}
+	var msgs []string
+	for _, p := range ps {
+		if p.Term == "" {
+			continue // the length of the query
+		}
+		msgs = append(msgs, p.Error())
+	}
+	return msgs
+}
+
+func (s *Server) deleteRules(c *call, ids []string, dryRun bool) {
+	del := make(map[string]bool)
+	var errs []map[string]string
+	for _, id := range ids {
+		if s.ruleLocked(id) == nil {
+			errs = append(errs, map[string]string{
+				"value":  id,
+				"title":  "Not Found Error",
+				"detail": "Rule does not exist",
+				"type":   problemBase + "resource-not-found",
+			})
+		} else {
+			del[id] = true
+		}
+	}
+	if !dryRun {
+		keep := s.rules[:0]
+		for _, r := range s.rules {
+			if !del[r.ID] {
+				keep = append(keep, r)
+			}
+		}
+		s.rules = keep
+	}
+	body := map[string]interface{}{
+		"meta": map[string]interface{}{
+			"sent":    sentTime(),
+			"summary": map[string]int{"deleted": len(del), "not_deleted": len(ids) - len(del)},
+		},
+	}
+	if len(errs) != 0 {
+		body["errors"] = errs
+	}
+	c.reply(body)
+}
+
+// ruleIDLocked returns the ID of the active or pending rule with the given
+// value, or "".
+func (s *Server) ruleIDLocked(value string, pending []*streamRule) string {
+	for _, rs := range [][]*streamRule{s.rules, pending} {
+		for _, r := range rs {
+			if r.Value == value {
+				return r.ID
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Server) ruleLocked(id string) *streamRule {
+	for _, r := range s.rules {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// sentTime returns the current time formatted for the "sent" field of rule
+// metadata.
+func sentTime() string { return time.Now().UTC().Format(time.RFC3339Nano) }
+
+// encodeMessage encodes v as a message on a stream.
+func encodeMessage(v interface{}) []byte {
+	var buf strings.Builder
+	json.NewEncoder(&buf).Encode(v)
+	return []byte(strings.TrimSuffix(buf.String(), "\n") + "\r\n")
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2022 Michael J. Fromberger. All Rights Reserved.
+
+package twittertest_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/rules"
+	"github.com/nankys/twitter/tweets"
+	"github.com/nankys/twitter/twittertest"
+	"github.com/nankys/twitter/types"
+)
+
+func TestStreamRules(t *testing.T) {
+	srv := twittertest.NewServer(&twittertest.Seed{MaxRules: 3})
+	defer srv.Close()
+	cli := srv.Client()
+	ctx := context.Background()
+
+	rsp, err := rules.Update(rules.Adds{
+		{Query: "cat OR kitten", Tag: "cats"},
+		{Query: "from:bob -is:retweet", Tag: "bob"},
+		{Query: "(dog", Tag: "unbalanced"},
+		{Query: "cat OR kitten", Tag: "duplicate"},
+	}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if s := rsp.Meta.Summary; s.Created != 2 || s.NotCreated != 2 {
+		t.Errorf("Summary: got %+v, want 2 created, 2 not created", s)
+	}
+	if len(rsp.Rules) != 2 || rsp.Rules[0].Tag != "cats" || rsp.Rules[0].ID == "" {
+		t.Errorf("Created rules: got %+v, want cats and bob", rsp.Rules)
+	}
+
+	// Validation does not change the active rules, but reports the rule cap.
+	vrs, err := rules.Validate(rules.Adds{{Query: "a"}, {Query: "b"}}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if s := vrs.Meta.Summary; s.Valid != 1 || s.Invalid != 1 || s.Created != 0 {
+		t.Errorf("Validate summary: got %+v, want 1 valid, 1 invalid", s)
+	}
+	if got := srv.Rules(); len(got) != 2 {
+		t.Errorf("Rules after validation: got %+v, want 2", got)
+	}
+
+	drs, err := rules.Update(rules.Deletes{rsp.Rules[1].ID, "nonesuch"}).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if s := drs.Meta.Summary; s.Deleted != 1 || s.NotDeleted != 1 {
+		t.Errorf("Delete summary: got %+v, want 1 deleted, 1 not deleted", s)
+	}
+	grs, err := rules.Get().Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(grs.Rules) != 1 || grs.Rules[0].Value != "cat OR kitten" {
+		t.Errorf("Get: got %+v, want cat OR kitten", grs.Rules)
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	srv := twittertest.NewServer(nil)
+	defer srv.Close()
+	cli := srv.Client()
+	ctx := context.Background()
+
+	// Rules are checked as query.ValidateString does, and the problems are
+	// reported in the details of each error.
+	bad := rules.Adds{{Query: "is:retweet"}, {Query: "-cat"}, {Query: "lang:xx cat"}}
+	rsp, err := rules.Validate(bad).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if len(rsp.Failed) != len(bad) {
+		t.Fatalf("Validate: got %d failures, want %d", len(rsp.Failed), len(bad))
+	}
+	for _, f := range rsp.Failed {
+		if len(f.Errors) != 1 || f.Errors[0].Title != "Invalid Rule" || len(f.Errors[0].Details) == 0 {
+			t.Errorf("Rule %q: got errors %+v, want an invalid rule with details", f.Rule.Value, f.Errors)
+		}
+	}
+	if got := srv.Rules(); len(got) != 0 {
+		t.Errorf("Rules: got %+v, want none", got)
+	}
+
+	// Search queries are checked the same way.
+	_, err = tweets.SearchRecent("is:retweet", nil).Invoke(ctx, cli)
+	var aerr *twitter.APIError
+	if !errors.As(err, &aerr) || aerr.Status != http.StatusBadRequest {
+		t.Errorf("SearchRecent: got %v, want an invalid request", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := twittertest.NewServer(&twittertest.Seed{
+		Users: []*types.User{{ID: "1", Username: "alice"}, {ID: "2", Username: "bob"}},
+	})
+	defer srv.Close()
+	cli := srv.Client()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := rules.Update(rules.Adds{
+		{Query: "cat OR kitten", Tag: "cats"},
+		{Query: "from:bob", Tag: "bob"},
+	}).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	t.Run("Wire", func(t *testing.T) {
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/2/tweets/search/stream", nil)
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Connecting to stream: %v", err)
+		}
+		defer rsp.Body.Close()
+		srv.KeepAlive()
+		srv.Inject(
+			&types.Tweet{Text: "a dog", AuthorID: "1"},
+			&types.Tweet{Text: "my cat", AuthorID: "2"},
+		)
+		srv.Disconnect()
+
+		var lines []string
+		sc := bufio.NewScanner(rsp.Body)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		if len(lines) != 2 || lines[0] != "" {
+			t.Fatalf("Stream: got %q, want a keep-alive and a tweet", lines)
+		}
+		var msg struct {
+			Data     *types.Tweet `json:"data"`
+			Matching []rules.Rule `json:"matching_rules"`
+		}
+		if err := json.Unmarshal([]byte(lines[1]), &msg); err != nil {
+			t.Fatalf("Decoding message: %v", err)
+		}
+		if msg.Data.Text != "my cat" || len(msg.Matching) != 2 ||
+			msg.Matching[0].Tag != "cats" || msg.Matching[1].Tag != "bob" {
+			t.Errorf("Message: got %+v, want my cat matching cats and bob", msg)
+		}
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		got := make(chan *tweets.Reply, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- tweets.SearchStream(func(rsp *tweets.Reply) error {
+				got <- rsp
+				return nil
+			}, &tweets.StreamOpts{
+				Optional: []types.Fields{types.Expansions{AuthorID: true}},
+			}).Invoke(ctx, cli)
+		}()
+		if err := srv.WaitStreams(ctx, 1); err != nil {
+			t.Fatalf("WaitStreams: %v", err)
+		}
+		if n := srv.Inject(&types.Tweet{Text: "a kitten", AuthorID: "1"}); n != 1 {
+			t.Errorf("Inject: delivered %d, want 1", n)
+		}
+		rsp := <-got
+		if users, err := rsp.IncludedUsers(); err != nil || len(users) != 1 || users[0].Username != "alice" {
+			t.Errorf("Included users: got %+v, %v; want alice", users, err)
+		}
+		if m := rsp.MatchingRules; len(m) != 1 || m[0].Tag != "cats" || m[0].ID == "" {
+			t.Errorf("Matching rules: got %+v, want cats", m)
+		}
+
+		// An error message without a tweet is delivered as an event.
+		srv.StreamError("ConnectionException", "Stream error for testing")
+		rsp = <-got
+		if len(rsp.Tweets) != 0 || len(rsp.Events) != 1 || rsp.Events[0].Kind != tweets.EventConnection {
+			t.Errorf("Stream error: got tweets %+v, events %+v; want a connection event", rsp.Tweets, rsp.Events)
+		}
+
+		// An operational disconnect is reported to the client.
+		srv.OperationalDisconnect("Stream disconnected for testing")
+		err := <-done
+		if err == nil {
+			t.Error("Stream: got nil error after operational disconnect")
+		}
+		rsp = <-got
+		if len(rsp.Events) != 1 || rsp.Events[0].Kind != tweets.EventDisconnect {
+			t.Errorf("Disconnect: got events %+v, want a disconnect event", rsp.Events)
+		}
+		var aerr *twitter.APIError
+		if !errors.As(err, &aerr) || aerr.Partial == nil || aerr.Partial.DisconnectType != "OperationalDisconnect" {
+			t.Errorf("Stream: got error %v, want an operational disconnect", err)
+		}
+	})
+
+	t.Run("Refused", func(t *testing.T) {
+		srv.RefuseStreams(1, http.StatusTooManyRequests)
+		err := tweets.SearchStream(func(*tweets.Reply) error { return nil }, nil).Invoke(ctx, cli)
+		if !errors.Is(err, twitter.ErrRateLimited) {
+			t.Errorf("Refused stream: got %v, want rate limited", err)
+		}
+	})
+}
@@ -2,6 +2,8 @@
 
 package types
 
+import "strings"
+
 // ErrorDetail describes an error condition reported in an otherwise successful
 // reply from the API, such as missing expansion data.
 //
@@ -9,12 +11,55 @@ package types
 type ErrorDetail struct {
 	// omitted: required_enrollment, registration_url
 
-	ClientID     string `json:"client_id,omitempty"` // e.g., "1011011"
-	Title        string `json:"title"`               // e.g., "Not Found Error"
-	Detail       string `json:"detail"`              // for human consumption
-	Parameter    string `json:"parameter"`           // e.g., "pinned_tweet_id"
-	Value        string `json:"value"`               // e.g., "12345"
-	Reason       string `json:"reason,omitempty"`    // e.g., "client-not-enrolled"
-	ResourceType string `json:"resource_type"`       // e.g., "tweet"
-	TypeURL      string `json:"type"`                // link to problem definition
+	ClientID     string   `json:"client_id,omitempty"` // e.g., "1011011"
+	Title        string   `json:"title"`               // e.g., "Not Found Error"
+	Detail       string   `json:"detail"`              // for human consumption
+	Details      []string `json:"details,omitempty"`   // for rule errors, in place of Detail
+	ID           string   `json:"id,omitempty"`        // e.g., the ID of an existing duplicate rule
+	Parameter    string   `json:"parameter"`           // e.g., "pinned_tweet_id"
+	Value        string   `json:"value"`               // e.g., "12345"
+	Reason       string   `json:"reason,omitempty"`    // e.g., "client-not-enrolled"
+	ResourceType string   `json:"resource_type"`       // e.g., "tweet"
+	TypeURL      string   `json:"type"`                // link to problem definition
+
+	// For errors reported on a stream, the kind of disconnection or connection
+	// problem, e.g., "OperationalDisconnect" or "TooManyConnections".
+	DisconnectType  string `json:"disconnect_type,omitempty"`
+	ConnectionIssue string `json:"connection_issue,omitempty"`
+}
+
+// A ResourceStatus describes the outcome of looking up a single resource, such
+// as a tweet or user, by ID or username.
+type ResourceStatus string
+
+// Values for ResourceStatus.
+const (
+	StatusFound     ResourceStatus = "found"     // the resource was returned
+	StatusNotFound  ResourceStatus = "not-found" // the resource does not exist
+	StatusDeleted   ResourceStatus = "deleted"   // the resource was deleted
+	StatusSuspended ResourceStatus = "suspended" // the owning account is suspended
+	StatusProtected ResourceStatus = "protected" // the caller is not authorized
+	StatusError     ResourceStatus = "error"     // some other error occurred
+)
+
+// Status classifies the resource status described by e.
+//
+// Note that the API reports most deleted resources as not found, so that
+// StatusNotFound does not imply the resource never existed.
+func (e *ErrorDetail) Status() ResourceStatus {
+	detail := strings.ToLower(e.Detail)
+	switch {
+	case strings.Contains(detail, "suspended"):
+		return StatusSuspended
+	case strings.Contains(detail, "deleted"):
+		return StatusDeleted
+	case strings.HasSuffix(e.TypeURL, "/not-authorized-for-resource"),
+		e.Title == "Authorization Error",
+		strings.Contains(detail, "not authorized"):
+		return StatusProtected
+	case strings.HasSuffix(e.TypeURL, "/resource-not-found"),
+		e.Title == "Not Found Error":
+		return StatusNotFound
+	}
+	return StatusError
 }
@@ -154,6 +154,12 @@ type Ref struct {
 	ID   string `json:"id"`
 }
 
+// A MatchingRule identifies a filtered stream rule matched by a tweet.
+type MatchingRule struct {
+	ID  string `json:"id"`
+	Tag string `json:"tag,omitempty"`
+}
+
 // Withholding describes content restrictions.
 type Withholding struct {
 	Copyright    bool     `json:"copyright"`
@@ -0,0 +1,99 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package users
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nankys/twitter"
+	"github.com/nankys/twitter/internal/bulk"
+)
+
+// BulkLookup constructs a query to look up any number of users by ID. When
+// the query is invoked, the IDs are split into batches of at most 100, which
+// are looked up concurrently and merged into a single reply. Duplicate IDs are
+// looked up only once.
+//
+// Each batch is an ordinary request, subject to the limiter and retry policy
+// of the client. To stay within rate limits for large lookups, set a Limiter
+// on the client that waits for the limit to reset.
+//
+// API: 2/users
+func BulkLookup(ids []string, opts *BulkOpts) BulkQuery {
+	return BulkQuery{lookup: Lookup, keys: ids, opts: opts}
+}
+
+// BulkLookupByName constructs a query to look up any number of users by
+// username, as BulkLookup does for IDs. Usernames are not case-sensitive, so
+// usernames that differ only in case are looked up once.
+//
+// API: 2/users/by
+func BulkLookupByName(names []string, opts *BulkOpts) BulkQuery {
+	return BulkQuery{lookup: LookupByName, keys: names, opts: opts, norm: strings.ToLower}
+}
+
+// BulkOpts provides parameters for bulk user lookup. A nil *BulkOpts provides
+// empty values for all fields.
+type BulkOpts = bulk.Opts
+
+// A BulkQuery performs a lookup query for any number of users.
+type BulkQuery struct {
+	lookup func(string, *LookupOpts) Query
+	keys   []string
+	opts   *BulkOpts
+	norm   func(string) string // if non-nil, identifies duplicate keys
+}
+
+// Invoke executes the query on the given context and client. The Users of the
+// reply contain the users from all batches, in batch order, and its Results
+// map has an entry for every requested key. The includes and error details of
+// all batches are merged into the reply.
+//
+// If any batch fails, Invoke stops issuing new batches and reports the error
+// from that batch, along with a reply that combines the batches that
+// succeeded. Keys that were not looked up have no entry in the Results map of
+// the reply.
+func (q BulkQuery) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
+	batches := bulk.Split(q.keys, bulk.MaxBatchSize, q.norm)
+	rsps := make([]*Reply, len(batches))
+	err := bulk.Run(ctx, batches, bulk.Concurrency(q.opts), func(ctx context.Context, i int, batch []string) error {
+		rsp, err := q.lookup(batch[0], &LookupOpts{
+			More:     batch[1:],
+			Optional: bulk.Optional(q.opts),
+		}).Invoke(ctx, cli)
+		if err == nil {
+			rsps[i] = rsp
+		}
+		return err
+	})
+
+	out := &Reply{Reply: new(twitter.Reply), Results: make(map[string]*LookupResult)}
+	for _, rsp := range rsps {
+		if rsp == nil {
+			continue // failed or not issued
+		}
+		if err := out.Reply.Merge(rsp.Reply); err != nil {
+			return nil, err
+		}
+		out.RateLimit = rsp.RateLimit
+		out.Users = append(out.Users, rsp.Users...)
+		for key, r := range rsp.Results {
+			out.Results[key] = r
+		}
+	}
+
+	// Report results for duplicate keys under each spelling requested.
+	if q.norm != nil {
+		byNorm := make(map[string]*LookupResult)
+		for key, r := range out.Results {
+			byNorm[q.norm(key)] = r
+		}
+		for _, key := range q.keys {
+			if r, ok := byNorm[q.norm(key)]; ok {
+				out.Results[key] = r
+			}
+		}
+	}
+	return out, err
+}
@@ -21,12 +21,21 @@
 //
 // To look up users by username, use users.LookupByName. As above, additional
 // usernames can be included in the option keys.
+//
+// The API accepts at most 100 IDs or usernames per request. To look up more,
+// use users.BulkLookup or users.BulkLookupByName, which split the keys into
+// batches and merge the results.
+//
+// Users that could not be found or accessed are not reported as an error.
+// Instead, the Results field of the Reply maps each requested ID or username
+// to the user, or to the ErrorDetail explaining why it was not returned.
 package users
 
 import (
 	"context"
 	"encoding/json"
 	"strconv"
+	"strings"
 
 	"github.com/creachadair/jhttp"
 	"github.com/nankys/twitter"
@@ -154,6 +163,11 @@ func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error)
 		return nil, &jhttp.Error{Data: rsp.Data, Message: "decoding users data", Err: err}
 	}
 	out := &Reply{Reply: rsp, Users: users}
+	for _, param := range []string{"ids", "usernames"} {
+		if keys, ok := q.Request.Params[param]; ok {
+			out.Results = lookupResults(param, keys, users, rsp.Errors)
+		}
+	}
 	q.Request.Params.Set(twitter.NextTokenParam, "")
 	if len(rsp.Meta) != 0 {
 		if err := json.Unmarshal(rsp.Meta, &out.Meta); err != nil {
@@ -179,11 +193,74 @@ func (q Query) HasMorePages() bool {
 // invoking the query will then fetch the first page of results.
 func (q Query) ResetPageToken() { q.Request.Params.Reset(twitter.NextTokenParam) }
 
+// FetchPage invokes the query to fetch the next page of results. The page
+// reply is a *Reply, and its items are *types.User values. This method
+// satisfies the twitter.Pageable interface.
+func (q Query) FetchPage(ctx context.Context, cli *twitter.Client) (*twitter.Page, error) {
+	rsp, err := q.Invoke(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, len(rsp.Users))
+	for i, v := range rsp.Users {
+		items[i] = v
+	}
+	return &twitter.Page{Reply: rsp, Items: items}, nil
+}
+
 // A Reply is the response from a Query.
 type Reply struct {
 	*twitter.Reply
 	Users types.Users
 	Meta  *twitter.Pagination
+
+	// For lookup queries, a map from each requested user ID or username to the
+	// result of looking up that user. This is nil for other queries.
+	Results map[string]*LookupResult
+}
+
+// A LookupResult reports the outcome of looking up a single user.
+type LookupResult struct {
+	User  *types.User        // the user, if found
+	Error *types.ErrorDetail // why the user was not found, if reported
+}
+
+// Status reports the status of the requested user.
+func (r *LookupResult) Status() types.ResourceStatus {
+	if r.User != nil {
+		return types.StatusFound
+	} else if r.Error != nil {
+		return r.Error.Status()
+	}
+	return types.StatusNotFound
+}
+
+// lookupResults matches the users and errors reported for a lookup by the
+// specified parameter ("ids" or "usernames") to the requested keys.
+// Usernames are not case-sensitive.
+func lookupResults(param string, keys []string, users types.Users, errs []*types.ErrorDetail) map[string]*LookupResult {
+	out := make(map[string]*LookupResult, len(keys))
+	byKey := make(map[string]*LookupResult, len(keys))
+	for _, key := range keys {
+		r := new(LookupResult)
+		out[key] = r
+		byKey[strings.ToLower(key)] = r
+	}
+	for _, u := range users {
+		key := u.ID
+		if param == "usernames" {
+			key = u.Username
+		}
+		if r, ok := byKey[strings.ToLower(key)]; ok {
+			r.User = u
+		}
+	}
+	for _, e := range errs {
+		if r, ok := byKey[strings.ToLower(e.Value)]; ok && e.Parameter == param && r.User == nil {
+			r.Error = e
+		}
+	}
+	return out
 }
 
 // LookupOpts provide parameters for user lookup. A nil *LookupOpts provides